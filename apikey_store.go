@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errAPIKeyNotFound = errors.New("api key not found")
+
+// apiKeyTouchInterval limits how often a key's last_used_at is written, so
+// a busy script does not turn every request into an UPDATE.
+const apiKeyTouchInterval = time.Minute
+
+// APIKeyStore persists API keys. Keys are never deleted, only revoked, so
+// listings keep showing what existed and when it was last used.
+type APIKeyStore interface {
+	Create(ctx context.Context, name, prefix string, hash []byte, scopes []string) (APIKey, error)
+	List(ctx context.Context) ([]APIKey, error)
+	// Lookup returns the unrevoked key with prefix and its stored hash, or
+	// errAPIKeyNotFound.
+	Lookup(ctx context.Context, prefix string) (APIKey, []byte, error)
+	// Touch records that key id was used at now, unless it was already
+	// recorded within apiKeyTouchInterval.
+	Touch(ctx context.Context, id int, now time.Time) error
+	// Revoke marks key id revoked. Revoking a revoked key is a no-op;
+	// an unknown id returns errAPIKeyNotFound.
+	Revoke(ctx context.Context, id int) error
+}
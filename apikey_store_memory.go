@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// memoryAPIKeyStore is an APIKeyStore kept in a map, used by tests.
+type memoryAPIKeyStore struct {
+	mu     sync.Mutex
+	keys   map[int]APIKey
+	hashes map[int][]byte
+	nextID int
+	now    func() time.Time
+}
+
+func newMemoryAPIKeyStore() *memoryAPIKeyStore {
+	return &memoryAPIKeyStore{
+		keys:   make(map[int]APIKey),
+		hashes: make(map[int][]byte),
+		nextID: 1,
+		now:    time.Now,
+	}
+}
+
+func (s *memoryAPIKeyStore) Create(ctx context.Context, name, prefix string, hash []byte, scopes []string) (APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return APIKey{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := APIKey{
+		ID:        s.nextID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    slices.Clone(scopes),
+		CreatedAt: s.now().UTC(),
+	}
+	s.keys[key.ID] = key
+	s.hashes[key.ID] = slices.Clone(hash)
+	s.nextID++
+	return key, nil
+}
+
+func (s *memoryAPIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b APIKey) int { return a.ID - b.ID })
+	return keys, nil
+}
+
+func (s *memoryAPIKeyStore) Lookup(ctx context.Context, prefix string) (APIKey, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return APIKey{}, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, key := range s.keys {
+		if key.Prefix == prefix && key.RevokedAt == nil {
+			return key, s.hashes[id], nil
+		}
+	}
+	return APIKey{}, nil, errAPIKeyNotFound
+}
+
+func (s *memoryAPIKeyStore) Touch(ctx context.Context, id int, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil
+	}
+	if key.LastUsedAt == nil || key.LastUsedAt.Before(now.Add(-apiKeyTouchInterval)) {
+		now = now.UTC()
+		key.LastUsedAt = &now
+		s.keys[id] = key
+	}
+	return nil
+}
+
+func (s *memoryAPIKeyStore) Revoke(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return errAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		now := s.now().UTC()
+		key.RevokedAt = &now
+		s.keys[id] = key
+	}
+	return nil
+}
@@ -1,33 +1,71 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"infrastructure-training-back/internal/config"
+	"infrastructure-training-back/internal/database"
+	"infrastructure-training-back/internal/migrate"
+	"infrastructure-training-back/migrations"
 )
 
 func main() {
-	var action string
-	flag.StringVar(&action, "action", "up", "Migration action: up, down, status")
+	var (
+		action string
+		steps  int
+		target string
+		copies string
+		format string
+		dryRun bool
+	)
+	flag.StringVar(&action, "action", "up", "Migration action: up, down, status, verify, plan")
+	flag.IntVar(&steps, "steps", 1, "Number of migrations to revert with -action=down")
+	flag.StringVar(&target, "to", "", "Revert down to this migration (kept applied) with -action=down")
+	flag.StringVar(&copies, "copies", strings.Join(defaultMigrationCopies, ","),
+		"Comma separated migration directories that must stay identical, checked by status and verify")
+	flag.BoolVar(&dryRun, "dry-run", false,
+		"With -action=up/down, execute the migrations in a transaction that is rolled back and report the plan")
+	flag.StringVar(&format, "format", "text", "Plan output format: text or json")
+	loader := config.Register(flag.CommandLine)
 	flag.Parse()
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+	cfg, err := loader.Load()
+	if loader.PrintRequested() && cfg != nil {
+		if err := cfg.Print(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if loader.PrintRequested() {
+		return
+	}
+
+	// Keep stdout clean for the JSON plan.
+	logOutput := os.Stdout
+	if format == "json" {
+		logOutput = os.Stderr
+	}
+	logger := slog.New(slog.NewJSONHandler(logOutput, &slog.HandlerOptions{
+		Level: cfg.Log.SlogLevel(),
 	}))
 	slog.SetDefault(logger)
 
-	// Change to project root directory
-	if err := os.Chdir(filepath.Join("..", "..")); err != nil {
-		slog.Error("Failed to change directory", "error", err)
+	loaded, err := migrate.Load(migrations.FS(cfg.Migrations.Dir))
+	if err != nil {
+		slog.Error("Failed to load migrations", "error", err)
 		os.Exit(1)
 	}
 
-	db, err := initDB()
+	db, err := database.Open(context.Background(), cfg.Database)
 	if err != nil {
 		slog.Error("Failed to initialize database", "error", err)
 		os.Exit(1)
@@ -39,21 +77,74 @@ func main() {
 		}
 	}(db)
 
+	m := migrate.New(db, loaded)
+	m.LockTimeout = cfg.Migrations.LockTimeout
+	ctx := context.Background()
+
+	if format != "text" && format != "json" {
+		fmt.Printf("Unknown format: %s\n", format)
+		os.Exit(1)
+	}
+
 	switch action {
+	case "plan":
+		plan, err := m.PlanUp(ctx)
+		if !showPlan(plan, err, format) {
+			os.Exit(1)
+		}
 	case "up":
-		if err := runMigrations(db); err != nil {
+		if dryRun {
+			plan, err := m.PlanUp(ctx)
+			if !showPlan(plan, err, format) {
+				os.Exit(1)
+			}
+			return
+		}
+		if err := m.Up(ctx); err != nil {
+			printVerifyReport(err)
 			slog.Error("Failed to run migrations", "error", err)
 			os.Exit(1)
 		}
 		slog.Info("Migrations completed successfully")
+	case "down":
+		if dryRun {
+			var plan *migrate.Plan
+			if target != "" {
+				plan, err = m.PlanDownTo(ctx, target)
+			} else {
+				plan, err = m.PlanDown(ctx, steps)
+			}
+			if !showPlan(plan, err, format) {
+				os.Exit(1)
+			}
+			return
+		}
+		if target != "" {
+			err = m.DownTo(ctx, target)
+		} else {
+			err = m.Down(ctx, steps)
+		}
+		if err != nil {
+			slog.Error("Failed to revert migrations", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Rollback completed successfully")
 	case "status":
-		if err := showMigrationStatus(db); err != nil {
+		if err := showMigrationStatus(m); err != nil {
 			slog.Error("Failed to show migration status", "error", err)
 			os.Exit(1)
 		}
+		if !verifyMigrations(m, strings.Split(copies, ",")) {
+			os.Exit(1)
+		}
+	case "verify":
+		if !verifyMigrations(m, strings.Split(copies, ",")) {
+			os.Exit(1)
+		}
+		slog.Info("Migrations verified successfully")
 	default:
 		fmt.Printf("Unknown action: %s\n", action)
-		fmt.Println("Available actions: up, status")
+		fmt.Println("Available actions: up, down, status, verify, plan")
 		os.Exit(1)
 	}
 }
@@ -1,218 +1,172 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
-	"time"
-)
-
-func initDB() (*sql.DB, error) {
-	host := os.Getenv("DB_HOST")
-	if host == "" {
-		host = "localhost"
-	}
 
-	port := os.Getenv("DB_PORT")
-	if port == "" {
-		port = "5432"
-	}
+	"infrastructure-training-back/internal/migrate"
+)
 
-	user := os.Getenv("DB_USER")
-	if user == "" {
-		user = "postgres"
+func showMigrationStatus(m *migrate.Migrator) error {
+	statuses, err := m.Status(context.Background())
+	if err != nil {
+		return err
 	}
 
-	password := os.Getenv("DB_PASSWORD")
-	if password == "" {
-		password = "postgres"
-	}
+	fmt.Println("Applied migrations:")
+	fmt.Println("===================")
 
-	dbname := os.Getenv("DB_NAME")
-	if dbname == "" {
-		dbname = "infrastructure_training"
+	count := 0
+	for _, s := range statuses {
+		if !s.Applied {
+			continue
+		}
+		note := ""
+		if s.Missing {
+			note = ", file missing"
+		} else if !s.Reversible {
+			note = ", irreversible"
+		}
+		fmt.Printf("✓ %s [%s] (applied: %s%s)\n", s.Name, s.Kind, s.AppliedAt.Format("2006-01-02 15:04:05"), note)
+		count++
 	}
 
-	sslmode := os.Getenv("DB_SSLMODE")
-	if sslmode == "" {
-		sslmode = "disable"
+	if count == 0 {
+		fmt.Println("No migrations applied yet")
 	}
 
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		host, port, user, password, dbname, sslmode)
+	fmt.Println("\nPending migrations:")
+	fmt.Println("==================")
 
-	db, err := sql.Open("postgres", psqlInfo)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	pendingCount := 0
+	for _, s := range statuses {
+		if !s.Applied {
+			fmt.Printf("✗ %s [%s]\n", s.Name, s.Kind)
+			pendingCount++
+		}
 	}
 
-	if err = db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	if pendingCount == 0 {
+		fmt.Println("No pending migrations")
 	}
 
-	slog.Info("Database connected successfully",
-		"host", host,
-		"port", port,
-		"user", user,
-		"dbname", dbname,
-	)
-
-	return db, nil
+	return nil
 }
 
-func runMigrations(db *sql.DB) error {
-	if err := createMigrationsTable(db); err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
-	}
+// defaultMigrationCopies are the migration directories, relative to the
+// project root, that are expected to hold identical files. Directories that
+// do not exist, e.g. when running outside a checkout, are skipped.
+var defaultMigrationCopies = []string{
+	"migrations",
+	filepath.Join("services", "app", "migrations"),
+	filepath.Join("services", "database", "migrations"),
+}
 
-	migrationsDir := "migrations"
-	files, err := os.ReadDir(migrationsDir)
-	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
-	}
+// verifyMigrations checks applied checksums and the migration copies,
+// printing a diff-style report for every problem found.
+func verifyMigrations(m *migrate.Migrator, dirs []string) bool {
+	ok := true
 
-	var sqlFiles []fs.DirEntry
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".sql") && !file.IsDir() {
-			sqlFiles = append(sqlFiles, file)
-		}
+	if err := m.Verify(context.Background()); err != nil {
+		printVerifyReport(err)
+		slog.Error("Applied migrations do not match their files", "error", err)
+		ok = false
 	}
 
-	sort.Slice(sqlFiles, func(i, j int) bool {
-		return sqlFiles[i].Name() < sqlFiles[j].Name()
-	})
-
-	for _, file := range sqlFiles {
-		migrationName := file.Name()
-
-		var exists bool
-		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM migrations WHERE name = $1)", migrationName).Scan(&exists)
-		if err != nil {
-			return fmt.Errorf("failed to check if migration %s exists: %w", migrationName, err)
-		}
-
-		if exists {
-			slog.Info("Migration already applied", "migration", migrationName)
+	sources := make([]migrate.Source, 0, len(dirs))
+	for _, dir := range dirs {
+		if dir = strings.TrimSpace(dir); dir == "" {
 			continue
 		}
-
-		filePath := filepath.Join(migrationsDir, migrationName)
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %w", migrationName, err)
-		}
-
-		tx, err := db.Begin()
-		if err != nil {
-			return fmt.Errorf("failed to begin transaction for migration %s: %w", migrationName, err)
-		}
-
-		if _, err := tx.Exec(string(content)); err != nil {
-			err := tx.Rollback()
-			if err != nil {
-				return err
-			}
-			return fmt.Errorf("failed to execute migration %s: %w", migrationName, err)
-		}
-
-		if _, err := tx.Exec("INSERT INTO migrations (name) VALUES ($1)", migrationName); err != nil {
-			err := tx.Rollback()
-			if err != nil {
-				return err
-			}
-			return fmt.Errorf("failed to record migration %s: %w", migrationName, err)
-		}
-
-		if err := tx.Commit(); err != nil {
-			return fmt.Errorf("failed to commit migration %s: %w", migrationName, err)
+		if _, err := os.Stat(dir); err != nil {
+			slog.Warn("Skipping migration copy", "dir", dir, "error", err)
+			continue
 		}
-
-		slog.Info("Applied migration", "migration", migrationName)
+		sources = append(sources, migrate.Source{Name: dir, FS: os.DirFS(dir)})
+	}
+	if err := migrate.CompareSources(sources); err != nil {
+		printVerifyReport(err)
+		slog.Error("Migration copies disagree", "error", err)
+		ok = false
 	}
 
-	return nil
+	return ok
 }
 
-func createMigrationsTable(db *sql.DB) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS migrations (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL UNIQUE,
-			applied_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-		)`
+func printVerifyReport(err error) {
+	var driftErr *migrate.DriftError
+	if errors.As(err, &driftErr) {
+		fmt.Fprint(os.Stderr, driftErr.Report())
+	}
 
-	_, err := db.Exec(query)
-	return err
+	var copyErr *migrate.CopyMismatchError
+	if errors.As(err, &copyErr) {
+		fmt.Fprint(os.Stderr, copyErr.Report)
+	}
 }
 
-func showMigrationStatus(db *sql.DB) error {
-	if err := createMigrationsTable(db); err != nil {
-		return fmt.Errorf("failed to create migrations table: %w", err)
-	}
+// planOutput is the JSON document printed by -format=json. Error is set when
+// the plan could not be built at all, e.g. because of checksum drift.
+type planOutput struct {
+	*migrate.Plan
+	Error string `json:"error,omitempty"`
+}
 
-	rows, err := db.Query("SELECT name, applied_at FROM migrations ORDER BY applied_at")
-	if err != nil {
-		return fmt.Errorf("failed to query migrations: %w", err)
-	}
-	defer func(rows *sql.Rows) {
-		err := rows.Close()
+// showPlan prints a dry-run plan and reports whether every step succeeded.
+func showPlan(plan *migrate.Plan, err error, format string) bool {
+	if format == "json" {
+		out := planOutput{Plan: plan}
 		if err != nil {
-			slog.Error("Failed to close rows", "error", err)
+			out.Error = err.Error()
 		}
-	}(rows)
-
-	fmt.Println("Applied migrations:")
-	fmt.Println("===================")
-
-	count := 0
-	for rows.Next() {
-		var name string
-		var appliedAt time.Time
-		if err := rows.Scan(&name, &appliedAt); err != nil {
-			return fmt.Errorf("failed to scan migration row: %w", err)
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(out); encodeErr != nil {
+			slog.Error("Failed to encode plan", "error", encodeErr)
+			return false
 		}
-		fmt.Printf("✓ %s (applied: %s)\n", name, appliedAt.Format("2006-01-02 15:04:05"))
-		count++
-	}
-
-	if count == 0 {
-		fmt.Println("No migrations applied yet")
+		if err != nil {
+			printVerifyReport(err)
+		}
+		return err == nil && plan.OK
 	}
 
-	// Check for pending migrations
-	migrationsDir := "migrations"
-	files, err := os.ReadDir(migrationsDir)
 	if err != nil {
-		return fmt.Errorf("failed to read migrations directory: %w", err)
+		printVerifyReport(err)
+		slog.Error("Failed to plan migrations", "error", err)
+		return false
 	}
 
-	fmt.Println("\nPending migrations:")
-	fmt.Println("==================")
+	title := fmt.Sprintf("Plan (%s): %d migration(s)", plan.Direction, len(plan.Steps))
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("=", len(title)))
 
-	pendingCount := 0
-	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".sql") && !file.IsDir() {
-			var exists bool
-			err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM migrations WHERE name = $1)", file.Name()).Scan(&exists)
-			if err != nil {
-				return fmt.Errorf("failed to check migration status: %w", err)
-			}
-
-			if !exists {
-				fmt.Printf("✗ %s\n", file.Name())
-				pendingCount++
-			}
-		}
+	if len(plan.Steps) == 0 {
+		fmt.Println("Nothing to do")
+		return true
 	}
 
-	if pendingCount == 0 {
-		fmt.Println("No pending migrations")
+	for _, step := range plan.Steps {
+		fmt.Printf("\n-- %s [%s]\n", step.Name, step.Kind)
+		if step.SQL != "" {
+			fmt.Println(strings.TrimRight(step.SQL, "\n"))
+		}
+		switch step.Status {
+		case migrate.StepOK:
+			fmt.Printf("✓ ok (%d ms)\n", step.DurationMS)
+		case migrate.StepFailed:
+			fmt.Printf("✗ failed: %s\n", step.Error)
+		case migrate.StepSkipped:
+			fmt.Println("- skipped after earlier failure")
+		}
 	}
 
-	return nil
+	fmt.Println("\nAll changes were rolled back.")
+	return plan.OK
 }
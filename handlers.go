@@ -31,7 +31,7 @@ func notesHandler(w http.ResponseWriter, r *http.Request) {
 		var req NoteRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid JSON"))
 			if err != nil {
 				return
 			}
@@ -40,7 +40,7 @@ func notesHandler(w http.ResponseWriter, r *http.Request) {
 
 		if req.Text == "" {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Text field is required"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Text field is required"))
 			if err != nil {
 				return
 			}
@@ -56,7 +56,7 @@ func notesHandler(w http.ResponseWriter, r *http.Request) {
 
 	default:
 		w.WriteHeader(http.StatusMethodNotAllowed)
-		err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Method not allowed"})
+		err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Method not allowed"))
 		if err != nil {
 			return
 		}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"infrastructure-training-back/internal/migrate"
+)
+
+const (
+	checkOK       = "ok"
+	checkDegraded = "degraded"
+	checkFailed   = "fail"
+)
+
+// healthCheck is one dependency probed by /readyz. A failing required check
+// makes the service unready; a failing optional one only degrades it.
+type healthCheck struct {
+	name     string
+	required bool
+	run      func(ctx context.Context) error
+}
+
+type CheckResult struct {
+	Status    string  `json:"status"`
+	Required  bool    `json:"required"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type ReadinessReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// readyzHandler runs every check concurrently, each bounded by timeout, and
+// answers 503 when a required dependency is down.
+func readyzHandler(timeout time.Duration, checks ...healthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		report := ReadinessReport{Status: checkOK, Checks: make(map[string]CheckResult, len(checks))}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, check := range checks {
+			wg.Add(1)
+			go func(check healthCheck) {
+				defer wg.Done()
+				result := runCheck(r.Context(), timeout, check)
+
+				mu.Lock()
+				defer mu.Unlock()
+				report.Checks[check.name] = result
+				switch {
+				case result.Status == checkFailed:
+					report.Status = checkFailed
+				case result.Status == checkDegraded && report.Status == checkOK:
+					report.Status = checkDegraded
+				}
+			}(check)
+		}
+		wg.Wait()
+
+		if report.Status == checkFailed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		err := json.NewEncoder(w).Encode(report)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func runCheck(ctx context.Context, timeout time.Duration, check healthCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.run(ctx) }()
+
+	// Not every client honours the context, so stop waiting at the deadline
+	// regardless.
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := CheckResult{
+		Status:    checkOK,
+		Required:  check.required,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Status = checkDegraded
+		if check.required {
+			result.Status = checkFailed
+		}
+	}
+	return result
+}
+
+func postgresCheck(db *sql.DB) healthCheck {
+	return healthCheck{name: "postgres", required: true, run: db.PingContext}
+}
+
+// migrationsCheck fails while migrations known to this binary have not been
+// applied yet, e.g. while another replica still holds the migration lock.
+func migrationsCheck(m *migrate.Migrator) healthCheck {
+	return healthCheck{name: "migrations", required: true, run: func(ctx context.Context) error {
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending: %s", len(pending), strings.Join(pending, ", "))
+		}
+		return nil
+	}}
+}
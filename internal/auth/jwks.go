@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Keys weaker than these are refused when loaded. The HMAC minimum matches
+// the one config validation applies to auth.hs256_secret.
+const (
+	minHMACKeyBytes = 32
+	minRSAKeyBits   = 2048
+)
+
+// jwk holds the members of a JSON Web Key used for RSA and symmetric keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+// loadJWKS adds the signing keys of the JWKS file at path to hmacKeys and
+// rsaKeys, indexed by key id.
+func loadJWKS(path string, hmacKeys map[string][]byte, rsaKeys map[string]*rsa.PublicKey) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("failed to parse JWKS %s: %w", path, err)
+	}
+
+	for i, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		switch key.Kty {
+		case "RSA":
+			if key.Alg != "" && key.Alg != "RS256" {
+				continue
+			}
+			pub, err := key.rsaPublicKey()
+			if err != nil {
+				return fmt.Errorf("JWKS %s key %d (%s): %w", path, i, key.Kid, err)
+			}
+			rsaKeys[key.Kid] = pub
+		case "oct":
+			if key.Alg != "" && key.Alg != "HS256" {
+				continue
+			}
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(secret) == 0 {
+				return fmt.Errorf("JWKS %s key %d (%s): invalid k", path, i, key.Kid)
+			}
+			if len(secret) < minHMACKeyBytes {
+				return fmt.Errorf("JWKS %s key %d (%s): HMAC key must be at least %d bytes, got %d",
+					path, i, key.Kid, minHMACKeyBytes, len(secret))
+			}
+			hmacKeys[key.Kid] = secret
+		}
+	}
+	return nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	exponent := 0
+	for _, b := range e {
+		exponent = exponent<<8 | int(b)
+	}
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}
+	if err := checkRSAKeySize(pub); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// checkRSAKeySize refuses RSA keys with a modulus under minRSAKeyBits.
+func checkRSAKeySize(key *rsa.PublicKey) error {
+	if bits := key.N.BitLen(); bits < minRSAKeyBits {
+		return fmt.Errorf("RSA key must be at least %d bits, got %d", minRSAKeyBits, bits)
+	}
+	return nil
+}
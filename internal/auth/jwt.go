@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"infrastructure-training-back/internal/config"
+)
+
+// ErrTokenExpired is returned for tokens past their exp claim, so callers
+// can tell clients to refresh rather than re-authenticate.
+var ErrTokenExpired = jwt.ErrTokenExpired
+
+// Verifier checks JWT signatures and registered claims. HMAC and RSA keys
+// are kept apart so a token can never be verified with a key of the other
+// family.
+type Verifier struct {
+	hmacKeys map[string][]byte
+	rsaKeys  map[string]*rsa.PublicKey
+	parser   *jwt.Parser
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	// Scope holds space-separated scopes as in RFC 8693. Some issuers use
+	// scp instead, as a string or a list.
+	Scope scopeClaim `json:"scope,omitempty"`
+	Scp   scopeClaim `json:"scp,omitempty"`
+}
+
+// scopeClaim reads scopes given either as one space-separated string or as
+// a JSON list of strings.
+type scopeClaim []string
+
+func (s *scopeClaim) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = strings.Fields(str)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("scope claim must be a string or a list of strings")
+	}
+	*s = list
+	return nil
+}
+
+// NewVerifier loads the keys named by cfg. Keys from the config file carry
+// no key id and are used for tokens whose kid matches no JWKS key.
+func NewVerifier(cfg config.AuthConfig) (*Verifier, error) {
+	v := &Verifier{
+		hmacKeys: make(map[string][]byte),
+		rsaKeys:  make(map[string]*rsa.PublicKey),
+	}
+
+	if cfg.HS256Secret != "" {
+		v.hmacKeys[""] = []byte(cfg.HS256Secret)
+	}
+	if cfg.RS256KeyFile != "" {
+		data, err := os.ReadFile(cfg.RS256KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RS256 key: %w", err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RS256 key %s: %w", cfg.RS256KeyFile, err)
+		}
+		if err := checkRSAKeySize(key); err != nil {
+			return nil, fmt.Errorf("RS256 key %s: %w", cfg.RS256KeyFile, err)
+		}
+		v.rsaKeys[""] = key
+	}
+	if cfg.JWKSFile != "" {
+		if err := loadJWKS(cfg.JWKSFile, v.hmacKeys, v.rsaKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	var methods []string
+	if len(v.hmacKeys) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if len(v.rsaKeys) > 0 {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no token verification keys configured")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify checks the token's signature, exp, nbf, iss and aud and returns
+// its subject and the scopes of its scope and scp claims. A token is granted
+// nothing else, so reading notes needs notes:read and writing notes:write.
+func (v *Verifier) Verify(token string) (Principal, error) {
+	var c claims
+	if _, err := v.parser.ParseWithClaims(token, &c, v.key); err != nil {
+		return Principal{}, err
+	}
+	if c.Subject == "" {
+		return Principal{}, errors.New("token has no sub claim")
+	}
+	if strings.HasPrefix(c.Subject, apiKeySubjectPrefix) {
+		return Principal{}, fmt.Errorf("token sub %q is reserved for API keys", c.Subject)
+	}
+	p := Principal{Subject: c.Subject}
+	for _, scope := range slices.Concat(c.Scope, c.Scp) {
+		if !p.HasScope(scope) {
+			p.Scopes = append(p.Scopes, scope)
+		}
+	}
+	return p, nil
+}
+
+func (v *Verifier) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		return lookupKey(v.hmacKeys, kid)
+	case *jwt.SigningMethodRSA:
+		return lookupKey(v.rsaKeys, kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+func lookupKey[K any](keys map[string]K, kid string) (K, error) {
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if key, ok := keys[""]; ok {
+		return key, nil
+	}
+	var zero K
+	return zero, fmt.Errorf("unknown key id %q", kid)
+}
@@ -0,0 +1,460 @@
+// Package config loads the application configuration from defaults, an
+// optional YAML or JSON file, environment variables and command-line flags,
+// in increasing order of precedence.
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Server     ServerConfig
+	Log        LogConfig
+	Database   DatabaseConfig
+	Migrations MigrationsConfig
+	Tracing    TracingConfig
+	Auth       AuthConfig
+	RateLimit  RateLimitConfig
+	CORS       CORSConfig
+
+	// sources records where each key's effective value came from.
+	sources map[string]string
+}
+
+type ServerConfig struct {
+	Port               int
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	IdleTimeout        time.Duration
+	ShutdownTimeout    time.Duration
+	HealthCheckTimeout time.Duration
+}
+
+type LogConfig struct {
+	Level string
+}
+
+// DatabaseConfig describes how to reach PostgreSQL. URL, when set, replaces
+// the individual connection fields.
+type DatabaseConfig struct {
+	URL      string
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// QueryTimeout bounds each database call made while serving a request.
+	QueryTimeout time.Duration
+
+	// ConnectTimeout bounds how long startup keeps retrying an unreachable
+	// database; ConnectBackoff and ConnectMaxBackoff shape the delays.
+	ConnectTimeout    time.Duration
+	ConnectBackoff    time.Duration
+	ConnectMaxBackoff time.Duration
+}
+
+type MigrationsConfig struct {
+	Dir         string
+	LockTimeout time.Duration
+}
+
+// AuthConfig configures authentication. Bearer tokens are verified against
+// an HS256 secret, an RS256 PEM public key, the keys of a local JWKS file, or
+// any combination of them. API keys from the database are always accepted
+// when authentication is enabled, so none of the token keys is required.
+type AuthConfig struct {
+	Enabled      bool
+	HS256Secret  string
+	RS256KeyFile string
+	JWKSFile     string
+	Issuer       string
+	Audience     string
+	Leeway       time.Duration
+	PublicPaths  []string
+}
+
+// TokensEnabled reports whether any bearer token verification key is set.
+func (c AuthConfig) TokensEnabled() bool {
+	return c.HS256Secret != "" || c.RS256KeyFile != "" || c.JWKSFile != ""
+}
+
+// RateLimitConfig limits how fast each client may call the API. Limits are
+// written "<requests>/<window>", such as "30/1m", or "off". Default applies
+// to every /api/ route without an entry in Routes; entries look like
+// "POST /api/notes=30/1m", with the route template registered in main.go.
+type RateLimitConfig struct {
+	Enabled bool
+	Default string
+	Routes  []string
+	// PerIP limits each client address across all /api/ routes before
+	// authentication, so requests with wrong credentials are throttled too.
+	PerIP string
+	// TrustProxy takes the client address from the last X-Forwarded-For
+	// entry, as added by a reverse proxy in front of the service.
+	TrustProxy bool
+}
+
+// RateLimit allows Requests per Window. The zero value means unlimited.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// ParseRateLimit parses "<requests>/<window>" or "off".
+func ParseRateLimit(s string) (RateLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" {
+		return RateLimit{}, nil
+	}
+	requests, window, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(requests)
+	if !ok || err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("must look like 30/1m or off, got %q", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("must look like 30/1m or off, got %q", s)
+	}
+	return RateLimit{Requests: n, Window: d}, nil
+}
+
+// RouteLimits parses Routes into limits keyed by "METHOD /route/template".
+func (c RateLimitConfig) RouteLimits() (map[string]RateLimit, error) {
+	limits := make(map[string]RateLimit, len(c.Routes))
+	for _, entry := range c.Routes {
+		route, limit, ok := strings.Cut(entry, "=")
+		method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || !hasPath || method == "" || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("must look like \"POST /api/notes=30/1m\", got %q", entry)
+		}
+		parsed, err := ParseRateLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = parsed
+	}
+	return limits, nil
+}
+
+// CORSConfig controls which browser origins may call the API. An allowed
+// origin is an exact scheme://host[:port], a pattern such as
+// https://*.example.com that matches any subdomain but not the domain
+// itself, or "*" for every origin, which cannot be combined with
+// AllowCredentials.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// TracingConfig selects where spans go: nowhere ("none"), an OTLP/HTTP
+// collector at Endpoint, or stdout for local debugging.
+type TracingConfig struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+}
+
+// Default returns the configuration used when nothing overrides a value. The
+// database password deliberately has no default.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:               8080,
+			ReadTimeout:        15 * time.Second,
+			WriteTimeout:       15 * time.Second,
+			IdleTimeout:        60 * time.Second,
+			ShutdownTimeout:    30 * time.Second,
+			HealthCheckTimeout: 2 * time.Second,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Database: DatabaseConfig{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "postgres",
+			Name:    "infrastructure_training",
+			SSLMode: "disable",
+
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			QueryTimeout:    5 * time.Second,
+
+			ConnectTimeout:    30 * time.Second,
+			ConnectBackoff:    500 * time.Millisecond,
+			ConnectMaxBackoff: 5 * time.Second,
+		},
+		Migrations: MigrationsConfig{
+			LockTimeout: time.Minute,
+		},
+		Auth: AuthConfig{
+			Leeway:      30 * time.Second,
+			PublicPaths: []string{"/health", "/livez", "/readyz", "/metrics", "/api/ping"},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Default: "300/1m",
+			Routes:  []string{"POST /api/notes=30/1m"},
+			PerIP:   "600/1m",
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID"},
+			ExposedHeaders: []string{"X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
+			MaxAge:         10 * time.Minute,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "localhost:4318",
+			ServiceName: "infrastructure-training-back",
+		},
+	}
+}
+
+// fields binds every configuration key to its environment variable and its
+// place in c. Flags are named after the keys.
+func (c *Config) fields() []field {
+	return []field{
+		{key: "server.port", env: "PORT", usage: "HTTP listen port", ptr: &c.Server.Port},
+		{key: "server.read_timeout", env: "SERVER_READ_TIMEOUT", usage: "HTTP read timeout", ptr: &c.Server.ReadTimeout},
+		{key: "server.write_timeout", env: "SERVER_WRITE_TIMEOUT", usage: "HTTP write timeout", ptr: &c.Server.WriteTimeout},
+		{key: "server.idle_timeout", env: "SERVER_IDLE_TIMEOUT", usage: "HTTP keep-alive idle timeout", ptr: &c.Server.IdleTimeout},
+		{key: "server.shutdown_timeout", env: "SERVER_SHUTDOWN_TIMEOUT", usage: "Graceful shutdown timeout", ptr: &c.Server.ShutdownTimeout},
+		{key: "server.health_check_timeout", env: "SERVER_HEALTH_CHECK_TIMEOUT", usage: "Timeout of each /readyz dependency check", ptr: &c.Server.HealthCheckTimeout},
+
+		{key: "log.level", env: "LOG_LEVEL", usage: "Log level: debug, info, warn, error", ptr: &c.Log.Level},
+
+		{key: "database.url", env: "DATABASE_URL", usage: "Full PostgreSQL connection URL, overrides the other connection settings", ptr: &c.Database.URL, url: true},
+		{key: "database.host", env: "DB_HOST", usage: "PostgreSQL host", ptr: &c.Database.Host},
+		{key: "database.port", env: "DB_PORT", usage: "PostgreSQL port", ptr: &c.Database.Port},
+		{key: "database.user", env: "DB_USER", usage: "PostgreSQL user", ptr: &c.Database.User},
+		{key: "database.password", env: "DB_PASSWORD", usage: "PostgreSQL password", ptr: &c.Database.Password, secret: true},
+		{key: "database.name", env: "DB_NAME", usage: "PostgreSQL database name", ptr: &c.Database.Name},
+		{key: "database.sslmode", env: "DB_SSLMODE", usage: "PostgreSQL sslmode", ptr: &c.Database.SSLMode},
+		{key: "database.max_open_conns", env: "DB_MAX_OPEN_CONNS", usage: "Maximum open connections, 0 for unlimited", ptr: &c.Database.MaxOpenConns},
+		{key: "database.max_idle_conns", env: "DB_MAX_IDLE_CONNS", usage: "Maximum idle connections", ptr: &c.Database.MaxIdleConns},
+		{key: "database.conn_max_lifetime", env: "DB_CONN_MAX_LIFETIME", usage: "Maximum connection lifetime, 0 for unlimited", ptr: &c.Database.ConnMaxLifetime},
+		{key: "database.conn_max_idle_time", env: "DB_CONN_MAX_IDLE_TIME", usage: "Maximum connection idle time, 0 for unlimited", ptr: &c.Database.ConnMaxIdleTime},
+		{key: "database.query_timeout", env: "DB_QUERY_TIMEOUT", usage: "Deadline of each database call made by a request", ptr: &c.Database.QueryTimeout},
+		{key: "database.connect_timeout", env: "DB_CONNECT_TIMEOUT", usage: "How long to keep retrying the database at startup", ptr: &c.Database.ConnectTimeout},
+		{key: "database.connect_backoff", env: "DB_CONNECT_BACKOFF", usage: "Initial delay between connection attempts", ptr: &c.Database.ConnectBackoff},
+		{key: "database.connect_max_backoff", env: "DB_CONNECT_MAX_BACKOFF", usage: "Maximum delay between connection attempts", ptr: &c.Database.ConnectMaxBackoff},
+
+		{key: "migrations.dir", env: "MIGRATIONS_DIR", usage: "Read migrations from this directory instead of the embedded ones", ptr: &c.Migrations.Dir},
+		{key: "migrations.lock_timeout", env: "MIGRATIONS_LOCK_TIMEOUT", usage: "How long to wait for the migration lock", ptr: &c.Migrations.LockTimeout},
+		{key: "auth.enabled", env: "AUTH_ENABLED", usage: "Require a bearer token or API key outside the public paths", ptr: &c.Auth.Enabled},
+		{key: "auth.hs256_secret", env: "AUTH_HS256_SECRET", usage: "Shared secret for HS256 tokens", ptr: &c.Auth.HS256Secret, secret: true},
+		{key: "auth.rs256_key_file", env: "AUTH_RS256_KEY_FILE", usage: "PEM public key for RS256 tokens", ptr: &c.Auth.RS256KeyFile},
+		{key: "auth.jwks_file", env: "AUTH_JWKS_FILE", usage: "Local JWKS file with verification keys", ptr: &c.Auth.JWKSFile},
+		{key: "auth.issuer", env: "AUTH_ISSUER", usage: "Required iss claim, empty to accept any", ptr: &c.Auth.Issuer},
+		{key: "auth.audience", env: "AUTH_AUDIENCE", usage: "Required aud claim, empty to accept any", ptr: &c.Auth.Audience},
+		{key: "auth.leeway", env: "AUTH_LEEWAY", usage: "Allowed clock skew for exp and nbf", ptr: &c.Auth.Leeway},
+		{key: "auth.public_paths", env: "AUTH_PUBLIC_PATHS", usage: "Comma-separated paths served without a token", ptr: &c.Auth.PublicPaths},
+		{key: "rate_limit.enabled", env: "RATE_LIMIT_ENABLED", usage: "Limit requests per API key, user or client IP", ptr: &c.RateLimit.Enabled},
+		{key: "rate_limit.default", env: "RATE_LIMIT_DEFAULT", usage: "Limit for /api/ routes without their own, such as 300/1m, or off", ptr: &c.RateLimit.Default},
+		{key: "rate_limit.routes", env: "RATE_LIMIT_ROUTES", usage: "Comma-separated per-route limits such as \"POST /api/notes=30/1m\"", ptr: &c.RateLimit.Routes},
+		{key: "rate_limit.per_ip", env: "RATE_LIMIT_PER_IP", usage: "Limit per client IP on /api/ routes, checked before authentication, such as 600/1m, or off", ptr: &c.RateLimit.PerIP},
+		{key: "rate_limit.trust_proxy", env: "RATE_LIMIT_TRUST_PROXY", usage: "Identify clients by the last X-Forwarded-For address", ptr: &c.RateLimit.TrustProxy},
+		{key: "cors.allowed_origins", env: "CORS_ALLOWED_ORIGINS", usage: "Comma-separated origins allowed to call the API: exact, https://*.example.com or *", ptr: &c.CORS.AllowedOrigins},
+		{key: "cors.allowed_headers", env: "CORS_ALLOWED_HEADERS", usage: "Comma-separated request headers browsers may send", ptr: &c.CORS.AllowedHeaders},
+		{key: "cors.exposed_headers", env: "CORS_EXPOSED_HEADERS", usage: "Comma-separated response headers browser scripts may read", ptr: &c.CORS.ExposedHeaders},
+		{key: "cors.allow_credentials", env: "CORS_ALLOW_CREDENTIALS", usage: "Allow cookies and Authorization on cross-origin requests", ptr: &c.CORS.AllowCredentials},
+		{key: "cors.max_age", env: "CORS_MAX_AGE", usage: "How long browsers may cache a preflight response", ptr: &c.CORS.MaxAge},
+		{key: "tracing.exporter", env: "TRACING_EXPORTER", usage: "Span exporter: none, otlp or stdout", ptr: &c.Tracing.Exporter},
+		{key: "tracing.endpoint", env: "TRACING_ENDPOINT", usage: "OTLP/HTTP collector host:port", ptr: &c.Tracing.Endpoint},
+		{key: "tracing.insecure", env: "TRACING_INSECURE", usage: "Send OTLP spans over plain HTTP", ptr: &c.Tracing.Insecure},
+		{key: "tracing.service_name", env: "TRACING_SERVICE_NAME", usage: "service.name resource attribute", ptr: &c.Tracing.ServiceName},
+	}
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+
+	problems = append(problems, checkPort("server.port", c.Server.Port)...)
+	problems = append(problems, checkPositive("server.read_timeout", c.Server.ReadTimeout)...)
+	problems = append(problems, checkPositive("server.write_timeout", c.Server.WriteTimeout)...)
+	problems = append(problems, checkPositive("server.idle_timeout", c.Server.IdleTimeout)...)
+	problems = append(problems, checkPositive("server.shutdown_timeout", c.Server.ShutdownTimeout)...)
+	problems = append(problems, checkPositive("server.health_check_timeout", c.Server.HealthCheckTimeout)...)
+
+	problems = append(problems, checkOneOf("log.level", c.Log.Level, "debug", "info", "warn", "error")...)
+
+	if c.Database.URL != "" {
+		u, err := url.Parse(c.Database.URL)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") || u.Host == "" {
+			problems = append(problems, "database.url: must be a postgres:// or postgresql:// URL")
+		}
+	} else {
+		problems = append(problems, checkRequired("database.host", c.Database.Host)...)
+		problems = append(problems, checkPort("database.port", c.Database.Port)...)
+		problems = append(problems, checkRequired("database.user", c.Database.User)...)
+		problems = append(problems, checkRequired("database.password", c.Database.Password)...)
+		problems = append(problems, checkRequired("database.name", c.Database.Name)...)
+		problems = append(problems, checkOneOf("database.sslmode", c.Database.SSLMode,
+			"disable", "allow", "prefer", "require", "verify-ca", "verify-full")...)
+	}
+	problems = append(problems, checkNotNegative("database.max_open_conns", c.Database.MaxOpenConns)...)
+	problems = append(problems, checkNotNegative("database.max_idle_conns", c.Database.MaxIdleConns)...)
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, fmt.Sprintf("database.max_idle_conns: must not exceed database.max_open_conns (%d), got %d",
+			c.Database.MaxOpenConns, c.Database.MaxIdleConns))
+	}
+	problems = append(problems, checkNotNegative("database.conn_max_lifetime", int(c.Database.ConnMaxLifetime))...)
+	problems = append(problems, checkNotNegative("database.conn_max_idle_time", int(c.Database.ConnMaxIdleTime))...)
+	problems = append(problems, checkPositive("database.query_timeout", c.Database.QueryTimeout)...)
+	problems = append(problems, checkPositive("database.connect_timeout", c.Database.ConnectTimeout)...)
+	problems = append(problems, checkPositive("database.connect_backoff", c.Database.ConnectBackoff)...)
+	problems = append(problems, checkPositive("database.connect_max_backoff", c.Database.ConnectMaxBackoff)...)
+
+	problems = append(problems, checkPositive("migrations.lock_timeout", c.Migrations.LockTimeout)...)
+	if c.Auth.HS256Secret != "" && len(c.Auth.HS256Secret) < 32 {
+		problems = append(problems, fmt.Sprintf("auth.hs256_secret: must be at least 32 bytes, got %d", len(c.Auth.HS256Secret)))
+	}
+	problems = append(problems, checkNotNegative("auth.leeway", int(c.Auth.Leeway))...)
+	if _, err := ParseRateLimit(c.RateLimit.Default); err != nil {
+		problems = append(problems, "rate_limit.default: "+err.Error())
+	}
+	if _, err := ParseRateLimit(c.RateLimit.PerIP); err != nil {
+		problems = append(problems, "rate_limit.per_ip: "+err.Error())
+	}
+	if _, err := c.RateLimit.RouteLimits(); err != nil {
+		problems = append(problems, "rate_limit.routes: "+err.Error())
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		problems = append(problems, checkOrigin("cors.allowed_origins", origin)...)
+	}
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		problems = append(problems, "cors.allowed_origins: \"*\" cannot be combined with cors.allow_credentials, list the origins")
+	}
+	problems = append(problems, checkNotNegative("cors.max_age", int(c.CORS.MaxAge))...)
+	problems = append(problems, checkOneOf("tracing.exporter", c.Tracing.Exporter, "none", "otlp", "stdout")...)
+	if c.Tracing.Exporter == "otlp" {
+		problems = append(problems, checkRequired("tracing.endpoint", c.Tracing.Endpoint)...)
+	}
+	problems = append(problems, checkRequired("tracing.service_name", c.Tracing.ServiceName)...)
+
+	return problems
+}
+
+// DSN returns the URL when set, otherwise a lib/pq connection string with
+// every value quoted.
+func (d DatabaseConfig) DSN() string {
+	if d.URL != "" {
+		return d.URL
+	}
+
+	quote := func(v string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quote(d.Host), d.Port, quote(d.User), quote(d.Password), quote(d.Name), quote(d.SSLMode))
+}
+
+// Target describes the database for logs without exposing the password.
+func (d DatabaseConfig) Target() string {
+	if d.URL != "" {
+		return redactURL(d.URL)
+	}
+	return fmt.Sprintf("%s@%s:%d/%s", d.User, d.Host, d.Port, d.Name)
+}
+
+// Addr returns the listen address for the HTTP server.
+func (s ServerConfig) Addr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+func checkRequired(key, value string) []string {
+	if value == "" {
+		return []string{key + ": is required"}
+	}
+	return nil
+}
+
+func checkPort(key string, port int) []string {
+	if port < 1 || port > 65535 {
+		return []string{fmt.Sprintf("%s: must be between 1 and 65535, got %d", key, port)}
+	}
+	return nil
+}
+
+func checkNotNegative(key string, n int) []string {
+	if n < 0 {
+		return []string{fmt.Sprintf("%s: must not be negative, got %d", key, n)}
+	}
+	return nil
+}
+
+func checkPositive(key string, d time.Duration) []string {
+	if d <= 0 {
+		return []string{fmt.Sprintf("%s: must be positive, got %s", key, d)}
+	}
+	return nil
+}
+
+func checkOneOf(key, value string, allowed ...string) []string {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return []string{fmt.Sprintf("%s: must be one of %s, got %q", key, strings.Join(allowed, ", "), value)}
+}
+
+// checkOrigin accepts "*" or scheme://host[:port], where the host may start
+// with "*." to match its subdomains.
+func checkOrigin(key, origin string) []string {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil ||
+		u.Path != "" || u.RawQuery != "" || u.Fragment != "" || !validOriginHost(u.Host) {
+		return []string{fmt.Sprintf("%s: must be \"*\" or scheme://host[:port], optionally with *. before the host, got %q", key, origin)}
+	}
+	return nil
+}
+
+func validOriginHost(host string) bool {
+	host = strings.TrimPrefix(host, "*.")
+	return host != "" && host[0] != '.' && host[0] != ':' && !strings.Contains(host, "*")
+}
+
+// SlogLevel converts the configured level name into a slog.Level.
+func (l LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// redactURL hides the password of a URL-shaped value.
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
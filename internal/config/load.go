@@ -0,0 +1,269 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "******"
+
+// field binds one configuration key to its environment variable and value.
+type field struct {
+	key    string
+	env    string
+	usage  string
+	ptr    any
+	secret bool
+	url    bool
+}
+
+func (f field) set(value string) error {
+	switch p := f.ptr.(type) {
+	case *string:
+		*p = value
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("not an integer")
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("not a boolean")
+		}
+		*p = b
+	case *time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("not a duration such as 500ms or 1m")
+		}
+		*p = d
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported field type %T", f.ptr)
+	}
+	return nil
+}
+
+// format renders the current value, hiding secrets that are set.
+func (f field) format() string {
+	var v string
+	switch p := f.ptr.(type) {
+	case *string:
+		v = *p
+	case *int:
+		v = strconv.Itoa(*p)
+	case *bool:
+		v = strconv.FormatBool(*p)
+	case *time.Duration:
+		v = p.String()
+	case *[]string:
+		v = strings.Join(*p, ",")
+	}
+	if f.secret && v != "" {
+		return redacted
+	}
+	if f.url && v != "" {
+		return redactURL(v)
+	}
+	return v
+}
+
+// ValidationError lists every problem found while loading the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Loader registers the configuration flags on a FlagSet and builds the
+// Config once the flags have been parsed.
+type Loader struct {
+	file       string
+	print      bool
+	flagValues map[string]string
+}
+
+// Register adds -config, -print-config and one flag per configuration key
+// (e.g. -database.host) to fs. Call Load after fs has been parsed.
+func Register(fs *flag.FlagSet) *Loader {
+	l := &Loader{flagValues: make(map[string]string)}
+
+	fs.StringVar(&l.file, "config", os.Getenv("CONFIG_FILE"), "Path to a YAML or JSON configuration file (env CONFIG_FILE)")
+	fs.BoolVar(&l.print, "print-config", false, "Print the effective configuration with secrets redacted and exit")
+
+	for _, f := range Default().fields() {
+		key := f.key
+		usage := fmt.Sprintf("%s (env %s", f.usage, f.env)
+		if def := f.format(); def != "" {
+			usage += ", default " + def
+		}
+		fs.Func(key, usage+")", func(v string) error {
+			l.flagValues[key] = v
+			return nil
+		})
+	}
+
+	return l
+}
+
+// PrintRequested reports whether -print-config was given.
+func (l *Loader) PrintRequested() bool {
+	return l.print
+}
+
+// Load applies the file, environment variables and flags on top of the
+// defaults and validates the result. On a *ValidationError the partially
+// loaded Config is returned as well so it can still be printed.
+func (l *Loader) Load() (*Config, error) {
+	cfg := Default()
+	cfg.sources = make(map[string]string)
+
+	fields := cfg.fields()
+	byKey := make(map[string]field, len(fields))
+	for _, f := range fields {
+		byKey[f.key] = f
+		cfg.sources[f.key] = "default"
+	}
+
+	var problems []string
+	apply := func(key, value, source string) {
+		f, ok := byKey[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown key in %s", key, source))
+			return
+		}
+		if err := f.set(value); err != nil {
+			shown := value
+			if f.secret || f.url {
+				shown = redacted
+			}
+			problems = append(problems, fmt.Sprintf("%s: invalid value %q from %s: %v", key, shown, source, err))
+			return
+		}
+		cfg.sources[key] = source
+	}
+
+	if l.file != "" {
+		values, err := readFile(l.file)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range sortedKeys(values) {
+			apply(key, values[key], "file "+l.file)
+		}
+	}
+
+	// Empty variables count as unset, as they always have for DB_* and
+	// REDIS_* in docker-compose.
+	for _, f := range fields {
+		if v := os.Getenv(f.env); v != "" {
+			apply(f.key, v, "env "+f.env)
+		}
+	}
+
+	for _, key := range sortedKeys(l.flagValues) {
+		apply(key, l.flagValues[key], "flag -"+key)
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// Print writes every key with its effective value and where it came from.
+func (c *Config) Print(w io.Writer) error {
+	for _, f := range c.fields() {
+		source := c.sources[f.key]
+		if source == "" {
+			source = "default"
+		}
+		if _, err := fmt.Fprintf(w, "%-28s = %-32s # %s\n", f.key, f.format(), source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFile parses a YAML or JSON file into flattened "section.key" values.
+func readFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &doc)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&doc)
+	default:
+		return nil, fmt.Errorf("config file %s must have a .yaml, .yml or .json extension", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", doc, values)
+	return values, nil
+}
+
+func flatten(prefix string, node map[string]any, out map[string]string) {
+	for k, v := range node {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(key, v, out)
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
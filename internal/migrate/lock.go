@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// lockKey identifies the session-level advisory lock taken for a whole
+// migration run. It fits in 32 bits so it shows up in pg_locks as
+// classid = 0, objid = lockKey, objsubid = 1.
+const lockKey int64 = 0x6d696772 // "migr"
+
+const lockPollInterval = 250 * time.Millisecond
+
+var ErrLockTimeout = errors.New("timed out waiting for migration lock")
+
+// lockHolder describes the backend holding the migration lock.
+type lockHolder struct {
+	PID             int
+	ApplicationName string
+	ClientAddr      string
+	User            string
+	BackendStart    time.Time
+}
+
+func (h lockHolder) String() string {
+	return fmt.Sprintf("pid %d (%s@%s, application %q, connected %s)",
+		h.PID, h.User, h.ClientAddr, h.ApplicationName, h.BackendStart.Format(time.RFC3339))
+}
+
+// withLock runs fn on a dedicated connection while holding the migration
+// advisory lock, so concurrent replicas apply each migration exactly once.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection for migration lock: %w", err)
+	}
+	defer func(conn *sql.Conn) {
+		err := conn.Close()
+		if err != nil {
+			slog.Error("Failed to close migration lock connection", "error", err)
+		}
+	}(conn)
+
+	if err := m.acquireLock(ctx, conn); err != nil {
+		return err
+	}
+	defer func() {
+		// The lock must be released even when ctx is already cancelled.
+		_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+		if err != nil {
+			slog.Error("Failed to release migration lock", "error", err)
+		}
+	}()
+
+	return fn(conn)
+}
+
+func (m *Migrator) acquireLock(ctx context.Context, conn *sql.Conn) error {
+	start := time.Now()
+	deadline := start.Add(m.LockTimeout)
+	waiting := false
+
+	for {
+		var acquired bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&acquired)
+		if err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if acquired {
+			if waiting {
+				slog.Info("Acquired migration lock", "waited", time.Since(start).String())
+			}
+			return nil
+		}
+
+		timedOut := !time.Now().Before(deadline)
+
+		// Only look the holder up when there is something to report.
+		var holder *lockHolder
+		if !waiting || timedOut {
+			holder, err = currentLockHolder(ctx, conn)
+			if err != nil {
+				slog.Warn("Failed to look up migration lock holder", "error", err)
+			}
+		}
+
+		if timedOut {
+			if holder != nil {
+				return fmt.Errorf("%w after %s, held by %s", ErrLockTimeout, m.LockTimeout, holder)
+			}
+			return fmt.Errorf("%w after %s", ErrLockTimeout, m.LockTimeout)
+		}
+
+		if !waiting && holder != nil {
+			slog.Info("Waiting for migration lock",
+				"holder_pid", holder.PID,
+				"holder_application", holder.ApplicationName,
+				"holder_addr", holder.ClientAddr,
+				"holder_user", holder.User,
+				"holder_since", holder.BackendStart,
+				"timeout", m.LockTimeout.String(),
+			)
+		}
+		waiting = true
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to acquire migration lock: %w", ctx.Err())
+		case <-time.After(min(lockPollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+// currentLockHolder returns the backend holding the migration lock, or nil
+// if it was released in the meantime.
+func currentLockHolder(ctx context.Context, conn *sql.Conn) (*lockHolder, error) {
+	var h lockHolder
+	err := conn.QueryRowContext(ctx, `
+		SELECT a.pid,
+		       COALESCE(a.application_name, ''),
+		       COALESCE(host(a.client_addr), 'local'),
+		       COALESCE(a.usename, ''),
+		       a.backend_start
+		FROM pg_locks l
+		JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory'
+		  AND l.granted
+		  AND l.classid = 0
+		  AND l.objid = $1
+		  AND l.objsubid = 1`,
+		lockKey).Scan(&h.PID, &h.ApplicationName, &h.ClientAddr, &h.User, &h.BackendStart)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
@@ -0,0 +1,361 @@
+// Package migrate applies and reverts the SQL migrations used by both the
+// server and the cmd/migrate tool.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
+
+// DefaultLockTimeout is how long a runner waits for another process holding
+// the migration lock before giving up.
+const DefaultLockTimeout = time.Minute
+
+// Migrator runs a fixed, sorted set of migrations against a database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+
+	// LockTimeout bounds the wait for the migration advisory lock.
+	LockTimeout time.Duration
+
+	// Observe, when set, is called after every migration applied or
+	// reverted with how long it took and the error it failed with, if any.
+	Observe func(name, direction string, duration time.Duration, err error)
+}
+
+// Status describes one migration as seen by both the files and the database.
+// Missing is set for migrations recorded as applied whose files are gone.
+type Status struct {
+	Name       string
+	Kind       string
+	Applied    bool
+	AppliedAt  time.Time
+	Reversible bool
+	Missing    bool
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// queryer is satisfied by *sql.DB, *sql.Conn and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// execer is satisfied by both *sql.DB and the *sql.Conn holding the lock.
+type execer interface {
+	queryer
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations, LockTimeout: DefaultLockTimeout}
+}
+
+// Up applies every pending migration in name order, each in its own
+// transaction. It refuses to run when an applied migration has drifted.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		if err := m.verify(ctx, conn); err != nil {
+			return err
+		}
+
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Name]; ok {
+				slog.Info("Migration already applied", "migration", migration.Name)
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration, DirectionUp); err != nil {
+				return err
+			}
+
+			slog.Info("Applied migration", "migration", migration.Name)
+		}
+
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.appliedNewestFirst(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return m.revert(ctx, conn, applied[:min(steps, len(applied))])
+	})
+}
+
+// DownTo reverts every migration applied after target, leaving target itself
+// applied. target may be a migration name or its ID.
+func (m *Migrator) DownTo(ctx context.Context, target string) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.appliedNewestFirst(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		toRevert, err := appliedAfter(applied, target)
+		if err != nil {
+			return err
+		}
+
+		return m.revert(ctx, conn, toRevert)
+	})
+}
+
+// appliedAfter returns the prefix of applied (newest first) that comes after
+// target. target may be a migration name or its ID.
+func appliedAfter(applied []appliedMigration, target string) ([]appliedMigration, error) {
+	for i, a := range applied {
+		if a.name == target || migrationID(a.name) == target {
+			return applied[:i], nil
+		}
+	}
+	return nil, fmt.Errorf("target migration %s is not applied", target)
+}
+
+// Pending returns the names of known migrations that are not applied yet.
+// Unlike Status it never creates or upgrades the migrations table, so it is
+// cheap enough for readiness probes; a missing table is reported as an error.
+func (m *Migrator) Pending(ctx context.Context) ([]string, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Name]; !ok {
+			pending = append(pending, migration.Name)
+		}
+	}
+	return pending, nil
+}
+
+// Status lists every known migration in name order, including applied ones
+// whose files no longer exist.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTable(ctx, m.db); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := Status{Name: migration.Name, Kind: migration.Kind(), Reversible: migration.Reversible()}
+		if a, ok := applied[migration.Name]; ok {
+			s.Applied = true
+			s.AppliedAt = a.appliedAt
+			delete(applied, migration.Name)
+		}
+		statuses = append(statuses, s)
+	}
+
+	for _, a := range applied {
+		kind := "sql"
+		if strings.HasSuffix(a.name, goSuffix) {
+			kind = "go"
+		}
+		statuses = append(statuses, Status{Name: a.name, Kind: kind, Applied: true, AppliedAt: a.appliedAt, Missing: true})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses, nil
+}
+
+func (m *Migrator) revert(ctx context.Context, conn execer, applied []appliedMigration) error {
+	toRevert, err := m.reversible(applied)
+	if err != nil {
+		return err
+	}
+
+	if len(toRevert) == 0 {
+		slog.Info("No migrations to revert")
+		return nil
+	}
+
+	for _, migration := range toRevert {
+		if err := m.apply(ctx, conn, migration, DirectionDown); err != nil {
+			return err
+		}
+
+		slog.Info("Reverted migration", "migration", migration.Name)
+	}
+
+	return nil
+}
+
+// reversible resolves applied migrations to their definitions. Everything is
+// checked up front so a missing down script does not leave the schema half
+// reverted.
+func (m *Migrator) reversible(applied []appliedMigration) ([]Migration, error) {
+	migrations := make([]Migration, 0, len(applied))
+	for _, a := range applied {
+		migration, ok := m.find(a.name)
+		if !ok {
+			return nil, fmt.Errorf("migration %s is applied but its file is missing", a.name)
+		}
+		if !migration.Reversible() {
+			return nil, fmt.Errorf("migration %s has no down migration", a.name)
+		}
+		migrations = append(migrations, migration)
+	}
+	return migrations, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn execer, migration Migration, direction string) (err error) {
+	if m.Observe != nil {
+		start := time.Now()
+		defer func() { m.Observe(migration.Name, direction, time.Since(start), err) }()
+	}
+
+	checksum := migration.Checksum
+	record := `
+		INSERT INTO migrations (name, direction, checksum)
+		VALUES ($1, 'up', $2)
+		ON CONFLICT (name) DO UPDATE
+		SET direction = 'up', checksum = EXCLUDED.checksum, applied_at = NOW()`
+	if direction == DirectionDown {
+		checksum = migration.downChecksum()
+		record = `
+			UPDATE migrations
+			SET direction = 'down', checksum = $2, applied_at = NOW()
+			WHERE name = $1`
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction for migration %s: %w", migration.Name, err)
+	}
+
+	if err := migration.run(ctx, tx, direction); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("failed to execute migration %s (%s): %v (rollback failed: %v)", migration.Name, direction, err, rollbackErr)
+		}
+		return fmt.Errorf("failed to execute migration %s (%s): %w", migration.Name, direction, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, record, migration.Name, checksum); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("failed to record migration %s: %v (rollback failed: %v)", migration.Name, err, rollbackErr)
+		}
+		return fmt.Errorf("failed to record migration %s: %w", migration.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", migration.Name, err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) find(name string) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Name == name {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
+
+// applied returns the migrations whose last recorded direction is up.
+func (m *Migrator) applied(ctx context.Context, conn queryer) (map[string]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT name, checksum, applied_at FROM migrations WHERE direction = 'up'")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query migrations: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+			slog.Error("Failed to close rows", "error", err)
+		}
+	}(rows)
+
+	applied := make(map[string]appliedMigration)
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration row: %w", err)
+		}
+		applied[a.name] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+func (m *Migrator) appliedNewestFirst(ctx context.Context, conn queryer) ([]appliedMigration, error) {
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]appliedMigration, 0, len(applied))
+	for _, a := range applied {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name > list[j].name
+	})
+
+	return list, nil
+}
+
+// ensureTable creates the migrations table and upgrades tables created before
+// direction and checksum were tracked.
+func (m *Migrator) ensureTable(ctx context.Context, conn queryer) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS migrations (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL UNIQUE,
+			applied_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+		);
+		ALTER TABLE migrations ADD COLUMN IF NOT EXISTS direction VARCHAR(4) NOT NULL DEFAULT 'up';
+		ALTER TABLE migrations ADD COLUMN IF NOT EXISTS checksum VARCHAR(64) NOT NULL DEFAULT ''`
+
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	StepOK      = "ok"
+	StepFailed  = "failed"
+	StepSkipped = "skipped"
+)
+
+// Plan is the outcome of a dry run: what would be applied or reverted and
+// whether each step executed successfully.
+type Plan struct {
+	Direction string     `json:"direction"`
+	Steps     []PlanStep `json:"steps"`
+	OK        bool       `json:"ok"`
+}
+
+type PlanStep struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	SQL        string `json:"sql,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// PlanUp dry-runs every pending migration.
+func (m *Migrator) PlanUp(ctx context.Context) (*Plan, error) {
+	return m.plan(ctx, DirectionUp, func(tx *sql.Tx) ([]Migration, error) {
+		applied, err := m.applied(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		var pending []Migration
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Name]; !ok {
+				pending = append(pending, migration)
+			}
+		}
+		return pending, nil
+	})
+}
+
+// PlanDown dry-runs reverting the last steps applied migrations.
+func (m *Migrator) PlanDown(ctx context.Context, steps int) (*Plan, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	return m.plan(ctx, DirectionDown, func(tx *sql.Tx) ([]Migration, error) {
+		applied, err := m.appliedNewestFirst(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		return m.reversible(applied[:min(steps, len(applied))])
+	})
+}
+
+// PlanDownTo dry-runs reverting every migration applied after target.
+func (m *Migrator) PlanDownTo(ctx context.Context, target string) (*Plan, error) {
+	return m.plan(ctx, DirectionDown, func(tx *sql.Tx) ([]Migration, error) {
+		applied, err := m.appliedNewestFirst(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+		toRevert, err := appliedAfter(applied, target)
+		if err != nil {
+			return nil, err
+		}
+		return m.reversible(toRevert)
+	})
+}
+
+// plan executes the selected migrations in order inside one transaction that
+// is always rolled back, including the migrations table bookkeeping, so a
+// dry run leaves the database untouched. Steps after the first failure are
+// skipped because they usually depend on it.
+func (m *Migrator) plan(ctx context.Context, direction string, selectSteps func(tx *sql.Tx) ([]Migration, error)) (*Plan, error) {
+	var plan *Plan
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin dry-run transaction: %w", err)
+		}
+		defer func(tx *sql.Tx) {
+			err := tx.Rollback()
+			if err != nil {
+				slog.Error("Failed to roll back dry-run transaction", "error", err)
+			}
+		}(tx)
+
+		if direction == DirectionUp {
+			if err := m.verify(ctx, tx); err != nil {
+				return err
+			}
+		} else if err := m.ensureTable(ctx, tx); err != nil {
+			return err
+		}
+
+		migrations, err := selectSteps(tx)
+		if err != nil {
+			return err
+		}
+
+		plan = &Plan{Direction: direction, Steps: make([]PlanStep, 0, len(migrations)), OK: true}
+		for _, migration := range migrations {
+			step := PlanStep{Name: migration.Name, Kind: migration.Kind(), SQL: migration.UpSQL}
+			if direction == DirectionDown {
+				step.SQL = migration.DownSQL
+			}
+
+			if !plan.OK {
+				step.Status = StepSkipped
+				plan.Steps = append(plan.Steps, step)
+				continue
+			}
+
+			start := time.Now()
+			err := migration.run(ctx, tx, direction)
+			step.DurationMS = time.Since(start).Milliseconds()
+			if err != nil {
+				step.Status = StepFailed
+				step.Error = err.Error()
+				plan.OK = false
+			} else {
+				step.Status = StepOK
+			}
+			plan.Steps = append(plan.Steps, step)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,206 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"infrastructure-training-back/internal/textdiff"
+)
+
+// Drift is an applied migration whose up script no longer matches the one
+// that was run. Current is empty when the file has been removed.
+type Drift struct {
+	Name     string
+	Recorded string
+	Current  string
+}
+
+// DriftError is returned when applied migrations were edited or removed.
+type DriftError struct {
+	Drifts []Drift
+}
+
+func (e *DriftError) Error() string {
+	names := make([]string, len(e.Drifts))
+	for i, d := range e.Drifts {
+		names[i] = d.Name
+	}
+	return fmt.Sprintf("%d applied migration(s) changed since they were applied: %s",
+		len(e.Drifts), strings.Join(names, ", "))
+}
+
+// Report renders the drift as a diff between the recorded and current
+// checksums.
+func (e *DriftError) Report() string {
+	var sb strings.Builder
+	for _, d := range e.Drifts {
+		fmt.Fprintf(&sb, "--- %s (applied)\n", d.Name)
+		if d.Current == "" {
+			sb.WriteString("+++ /dev/null (file missing)\n")
+		} else {
+			fmt.Fprintf(&sb, "+++ %s (on disk)\n", d.Name)
+		}
+		fmt.Fprintf(&sb, "-sha256 %s\n", d.Recorded)
+		if d.Current != "" {
+			fmt.Fprintf(&sb, "+sha256 %s\n", d.Current)
+		}
+	}
+	return sb.String()
+}
+
+// Verify compares the checksum recorded for every applied migration with its
+// current up script and returns a *DriftError on mismatch. Migrations
+// applied before checksums were recorded get their current checksum stored.
+func (m *Migrator) Verify(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		return m.verify(ctx, conn)
+	})
+}
+
+func (m *Migrator) verify(ctx context.Context, conn queryer) error {
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	var drifts []Drift
+	for _, a := range applied {
+		migration, ok := m.find(a.name)
+		if !ok {
+			drifts = append(drifts, Drift{Name: a.name, Recorded: a.checksum})
+			continue
+		}
+
+		// Go migrations have no script to checksum.
+		if migration.IsGo() {
+			continue
+		}
+
+		if a.checksum == "" {
+			_, err := conn.ExecContext(ctx,
+				"UPDATE migrations SET checksum = $2 WHERE name = $1 AND checksum = ''",
+				a.name, migration.Checksum)
+			if err != nil {
+				return fmt.Errorf("failed to record checksum for migration %s: %w", a.name, err)
+			}
+			slog.Warn("Recorded checksum for migration applied without one", "migration", a.name)
+			continue
+		}
+
+		if a.checksum != migration.Checksum {
+			drifts = append(drifts, Drift{Name: a.name, Recorded: a.checksum, Current: migration.Checksum})
+		}
+	}
+
+	if len(drifts) == 0 {
+		return nil
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].Name < drifts[j].Name
+	})
+	return &DriftError{Drifts: drifts}
+}
+
+// Source is a named copy of the migrations directory.
+type Source struct {
+	Name string
+	FS   fs.FS
+}
+
+// CopyMismatchError is returned when copies of the migrations directory
+// disagree. Report holds a unified diff against the first copy.
+type CopyMismatchError struct {
+	Files  []string
+	Report string
+}
+
+func (e *CopyMismatchError) Error() string {
+	return fmt.Sprintf("migration copies disagree on %d file(s): %s", len(e.Files), strings.Join(e.Files, ", "))
+}
+
+// CompareSources checks that every source holds the same .sql files with the
+// same content as the first one.
+func CompareSources(sources []Source) error {
+	if len(sources) < 2 {
+		return nil
+	}
+
+	contents := make([]map[string]string, len(sources))
+	names := make(map[string]bool)
+	for i, src := range sources {
+		files, err := readSQLFiles(src.FS)
+		if err != nil {
+			return fmt.Errorf("failed to read migrations in %s: %w", src.Name, err)
+		}
+		contents[i] = files
+		for name := range files {
+			names[name] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	ref := sources[0]
+	var mismatched []string
+	var report strings.Builder
+	for _, name := range sorted {
+		refContent, inRef := contents[0][name]
+		differs := false
+		for i, src := range sources[1:] {
+			content, ok := contents[i+1][name]
+			switch {
+			case !inRef && ok:
+				fmt.Fprintf(&report, "Only in %s: %s\n", src.Name, name)
+				differs = true
+			case inRef && !ok:
+				fmt.Fprintf(&report, "Only in %s: %s (missing from %s)\n", ref.Name, name, src.Name)
+				differs = true
+			case content != refContent:
+				report.WriteString(textdiff.Unified(ref.Name+"/"+name, src.Name+"/"+name, refContent, content, 3))
+				differs = true
+			}
+		}
+		if differs {
+			mismatched = append(mismatched, name)
+		}
+	}
+
+	if len(mismatched) == 0 {
+		return nil
+	}
+	return &CopyMismatchError{Files: mismatched, Report: report.String()}
+}
+
+func readSQLFiles(fsys fs.FS) (map[string]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), sqlSuffix) {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = string(content)
+	}
+	return files, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels requests no route matched, keeping raw paths out of
+// the label set.
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route template and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	migrationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "migrations_total",
+		Help: "Migrations applied or reverted by this process, by direction and result.",
+	}, []string{"direction", "result"})
+
+	migrationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "migration_duration_seconds",
+		Help:    "Time spent applying or reverting a single migration.",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60},
+	}, []string{"direction"})
+)
+
+// newMetricsRegistry returns a registry with the HTTP and migration metrics,
+// the connection pool stats of db, Go runtime metrics and any extra
+// collectors.
+func newMetricsRegistry(db *sql.DB, extra ...prometheus.Collector) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "postgres"),
+		httpRequestsTotal,
+		httpRequestDuration,
+		migrationsTotal,
+		migrationDuration,
+	)
+	reg.MustRegister(extra...)
+	return reg
+}
+
+func metricsHandler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
+
+// metricsMiddleware wraps the whole router rather than being installed with
+// Use, so requests that match no route are counted too.
+func metricsMiddleware(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unmatchedRoute
+		var match mux.RouteMatch
+		if router.Match(r, &match) && match.Route != nil {
+			if tmpl, err := match.Route.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		start := time.Now()
+		rw := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		router.ServeHTTP(rw, r)
+
+		method := metricMethod(r.Method)
+		status := strconv.Itoa(rw.statusCode)
+		httpRequestsTotal.WithLabelValues(method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricMethod folds unknown methods into one label value so clients cannot
+// grow the series count.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+func observeMigration(_, direction string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	migrationsTotal.WithLabelValues(direction, result).Inc()
+	migrationDuration.WithLabelValues(direction).Observe(duration.Seconds())
+}
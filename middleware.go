@@ -8,7 +8,6 @@ import (
 
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestID := generateRequestID()
 		start := time.Now()
 
 		rw := &responseWriter{
@@ -16,8 +15,7 @@ func loggingMiddleware(next http.Handler) http.Handler {
 			statusCode:     http.StatusOK,
 		}
 
-		slog.Info("Request started",
-			"request_id", requestID,
+		slog.InfoContext(r.Context(), "Request started",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"remote_addr", r.RemoteAddr,
@@ -27,8 +25,7 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(rw, r)
 
 		duration := time.Since(start)
-		slog.Info("Request completed",
-			"request_id", requestID,
+		slog.InfoContext(r.Context(), "Request completed",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status_code", rw.statusCode,
@@ -38,18 +35,3 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		)
 	})
 }
-
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
@@ -0,0 +1,8 @@
+-- Soft delete: DELETE /api/notes/{id} moves a note to the trash by setting
+-- deleted_at, and only a purge removes the row.
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Serve trash pages without scanning the user's live notes
+CREATE INDEX IF NOT EXISTS idx_notes_trash ON notes (user_id, created_at DESC, id DESC)
+    WHERE deleted_at IS NOT NULL;
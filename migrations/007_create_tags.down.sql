@@ -0,0 +1,3 @@
+-- Drop tags and their assignments to notes
+DROP TABLE IF EXISTS note_tags;
+DROP TABLE IF EXISTS tags;
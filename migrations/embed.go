@@ -0,0 +1,23 @@
+// Package migrations embeds the SQL migrations so the binaries do not depend
+// on the working directory. Migrations that are easier to write in Go, such
+// as data backfills, live here too as files that call migrate.Register from
+// init, named so they sort among the SQL files.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// FS returns the migrations to run. A non-empty dir replaces the embedded
+// files with an on-disk directory, which is handy while writing migrations.
+func FS(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return files
+}
@@ -1,113 +1,161 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
+
+	"infrastructure-training-back/internal/auth"
+)
+
+const (
+	// maxNoteTextLength bounds note text in characters, and with it the work
+	// of diffing two revisions.
+	maxNoteTextLength = 100000
+	// maxRequestBodyBytes bounds JSON request bodies. It fits the longest
+	// note text with tags and JSON escaping.
+	maxRequestBodyBytes = 1 << 20
 )
 
+var noteTextTooLong = "Text must be at most " + strconv.Itoa(maxNoteTextLength) + " characters"
+
 type Note struct {
 	ID        int       `json:"id" db:"id"`
 	Text      string    `json:"text" db:"text"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// DeletedAt is set while the note is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Tags are normalized and sorted by name.
+	Tags []string `json:"tags" db:"tags"`
+}
+
+// NotesPage is the response envelope for GET /api/notes. NextCursor is nil on
+// the last page.
+type NotesPage struct {
+	Notes      []Note  `json:"notes"`
+	NextCursor *string `json:"next_cursor"`
 }
 
 type NoteCreateRequest struct {
-	Text string `json:"text"`
+	Text string   `json:"text"`
+	Tags []string `json:"tags"`
+}
+
+// NoteUpdateRequest replaces the whole note, so leaving out tags removes
+// them.
+type NoteUpdateRequest struct {
+	Text string   `json:"text"`
+	Tags []string `json:"tags"`
 }
 
-func getNotesHandler(db *sql.DB) http.HandlerFunc {
+type NotePatchRequest struct {
+	Text *string   `json:"text"`
+	Tags *[]string `json:"tags"`
+}
+
+// noteOwner returns the user whose notes a request works with: the
+// authenticated principal, or the anonymous user "" when authentication is
+// disabled.
+func noteOwner(ctx context.Context) string {
+	principal, _ := auth.FromContext(ctx)
+	return principal.Subject
+}
+
+func getNotesHandler(store NoteStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		rows, err := db.Query("SELECT id, text, created_at, updated_at FROM notes ORDER BY created_at DESC")
+		limit, cursor, err := parsePageParams(r.URL.Query())
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database error"})
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid pagination parameters"))
 			if err != nil {
 				return
 			}
 			return
 		}
-		defer func(rows *sql.Rows) {
-			err := rows.Close()
-			if err != nil {
-
-			}
-		}(rows)
 
-		var notes []Note
-		for rows.Next() {
-			var note Note
-			err := rows.Scan(&note.ID, &note.Text, &note.CreatedAt, &note.UpdatedAt)
+		filter, err := parseNoteFilter(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid tag filter"))
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database scan error"})
-				if err != nil {
-					return
-				}
 				return
 			}
-			notes = append(notes, note)
+			return
 		}
 
-		if notes == nil {
-			notes = []Note{}
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		page, err := store.List(queryCtx, noteOwner(r.Context()), filter, limit, cursor)
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
 		}
 
 		w.WriteHeader(http.StatusOK)
-		err = json.NewEncoder(w).Encode(notes)
+		err = json.NewEncoder(w).Encode(page)
 		if err != nil {
 			return
 		}
 	}
 }
 
-func createNoteHandler(db *sql.DB) http.HandlerFunc {
+func createNoteHandler(store NoteStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		var req NoteCreateRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if !decodeRequestBody(w, r, &req) {
+			return
+		}
+
+		if req.Text == "" {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Text field is required"))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		if req.Text == "" {
+		if utf8.RuneCountInString(req.Text) > maxNoteTextLength {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Text field is required"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), noteTextTooLong))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		var note Note
-		err := db.QueryRow(`
-			INSERT INTO notes (text) 
-			VALUES ($1) 
-			RETURNING id, text, created_at, updated_at`,
-			req.Text).Scan(&note.ID, &note.Text, &note.CreatedAt, &note.UpdatedAt)
-
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database error"})
+		tags, problem := normalizeTags(req.Tags)
+		if problem != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), problem))
 			if err != nil {
 				return
 			}
 			return
 		}
 
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		note, err := store.Create(queryCtx, noteOwner(r.Context()), req.Text, tags)
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
 		w.WriteHeader(http.StatusCreated)
 		err = json.NewEncoder(w).Encode(note)
 		if err != nil {
@@ -116,7 +164,7 @@ func createNoteHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-func deleteNoteHandler(db *sql.DB) http.HandlerFunc {
+func deleteNoteHandler(store NoteStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
@@ -124,7 +172,7 @@ func deleteNoteHandler(db *sql.DB) http.HandlerFunc {
 		idStr, exists := vars["id"]
 		if !exists {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "ID is required"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "ID is required"))
 			if err != nil {
 				return
 			}
@@ -134,46 +182,349 @@ func deleteNoteHandler(db *sql.DB) http.HandlerFunc {
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid ID format"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		err = store.Delete(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(map[string]string{"message": "Note moved to trash"})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// getTrashHandler lists trashed notes, paginated like GET /api/notes. The
+// trash is not cached.
+func getTrashHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit, cursor, err := parsePageParams(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid pagination parameters"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		page, err := store.Trash(queryCtx, noteOwner(r.Context()), limit, cursor)
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func restoreNoteHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		result, err := db.Exec("DELETE FROM notes WHERE id = $1", id)
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		note, err := store.Restore(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found in trash"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(note)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// purgeNoteHandler removes a trashed note permanently.
+func purgeNoteHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database error"})
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		err = store.Purge(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found in trash"))
 			if err != nil {
 				return
 			}
 			return
 		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
 
-		rowsAffected, err := result.RowsAffected()
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(map[string]string{"message": "Note purged"})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database error"})
+			return
+		}
+	}
+}
+
+func getNoteHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		if rowsAffected == 0 {
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		note, err := store.Get(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
 			w.WriteHeader(http.StatusNotFound)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Note not found"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found"))
 			if err != nil {
 				return
 			}
 			return
 		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
 
 		w.WriteHeader(http.StatusOK)
-		err = json.NewEncoder(w).Encode(map[string]string{"message": "Note deleted successfully"})
+		err = json.NewEncoder(w).Encode(note)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func updateNoteHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		var req NoteUpdateRequest
+		if !decodeRequestBody(w, r, &req) {
+			return
+		}
+
+		if req.Text == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Text field is required"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		if utf8.RuneCountInString(req.Text) > maxNoteTextLength {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), noteTextTooLong))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		tags, problem := normalizeTags(req.Tags)
+		if problem != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), problem))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		writeUpdatedNote(r.Context(), w, store, id, noteChanges{Text: &req.Text, Tags: &tags})
+	}
+}
+
+func patchNoteHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		var req NotePatchRequest
+		if !decodeRequestBody(w, r, &req) {
+			return
+		}
+
+		if req.Text == nil && req.Tags == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "No fields to update"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		if req.Text != nil && *req.Text == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Text field cannot be empty"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		if req.Text != nil && utf8.RuneCountInString(*req.Text) > maxNoteTextLength {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), noteTextTooLong))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		changes := noteChanges{Text: req.Text}
+		if req.Tags != nil {
+			tags, problem := normalizeTags(*req.Tags)
+			if problem != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), problem))
+				if err != nil {
+					return
+				}
+				return
+			}
+			changes.Tags = &tags
+		}
+
+		writeUpdatedNote(r.Context(), w, store, id, changes)
+	}
+}
+
+// decodeRequestBody reads a JSON request body into v, capped at
+// maxRequestBodyBytes. It responds 400 or 413 and returns false when the
+// body cannot be used.
+func decodeRequestBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+
+	status, message := http.StatusBadRequest, "Invalid JSON"
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		status, message = http.StatusRequestEntityTooLarge, "Request body too large"
+	}
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(newErrorResponse(r.Context(), message))
+	if err != nil {
+		return false
+	}
+	return false
+}
+
+// writeUpdatedNote applies changes and responds with the updated note.
+func writeUpdatedNote(ctx context.Context, w http.ResponseWriter, store NoteStore, id int, changes noteChanges) {
+	queryCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	note, err := store.Update(queryCtx, noteOwner(ctx), id, changes)
+	if errors.Is(err, errNoteNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		err := json.NewEncoder(w).Encode(newErrorResponse(ctx, "Note not found"))
 		if err != nil {
 			return
 		}
+		return
+	}
+	if err != nil {
+		writeDatabaseError(queryCtx, w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(note)
+	if err != nil {
+		return
 	}
 }
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/textdiff"
+)
+
+// NoteRevision is one version of a note's text. Revision 1 is the text the
+// note was created with. Only a note's owner can change it, so revisions
+// carry no author of their own.
+type NoteRevision struct {
+	Revision  int       `json:"revision" db:"revision"`
+	Text      string    `json:"text" db:"text"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// NoteDiff is the response of GET /api/notes/{id}/diff. Diff is a unified
+// diff from revision From to revision To, empty when their texts are equal.
+type NoteDiff struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
+}
+
+// revisionDiffContext is the number of unchanged lines shown around each
+// change in a revision diff.
+const revisionDiffContext = 3
+
+func getNoteRevisionsHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		revisions, err := store.Revisions(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(revisions)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func getNoteRevisionHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, revision, err := parseRevisionVars(mux.Vars(r))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		result, err := store.Revision(queryCtx, noteOwner(r.Context()), id, revision)
+		if err != nil {
+			writeRevisionError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(result)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// diffNoteRevisionsHandler answers GET /api/notes/{id}/diff?from=&to= with
+// the changes between two revisions of a note.
+func diffNoteRevisionsHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		from, fromErr := strconv.Atoi(r.URL.Query().Get("from"))
+		to, toErr := strconv.Atoi(r.URL.Query().Get("to"))
+		if fromErr != nil || toErr != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Query parameters from and to must be revision numbers"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		fromRevision, err := store.Revision(queryCtx, noteOwner(r.Context()), id, from)
+		if err != nil {
+			writeRevisionError(queryCtx, w, err)
+			return
+		}
+
+		toRevision, err := store.Revision(queryCtx, noteOwner(r.Context()), id, to)
+		if err != nil {
+			writeRevisionError(queryCtx, w, err)
+			return
+		}
+
+		diff := textdiff.Unified(
+			"revisions/"+strconv.Itoa(from), "revisions/"+strconv.Itoa(to),
+			fromRevision.Text, toRevision.Text, revisionDiffContext)
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(NoteDiff{From: from, To: to, Diff: diff})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// restoreNoteRevisionHandler makes the text of an old revision the current
+// text of a note. The restore is an update, so it is recorded as a new
+// revision rather than rewinding the history.
+func restoreNoteRevisionHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, revision, err := parseRevisionVars(mux.Vars(r))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		result, err := store.Revision(queryCtx, noteOwner(r.Context()), id, revision)
+		if err != nil {
+			writeRevisionError(queryCtx, w, err)
+			return
+		}
+
+		writeUpdatedNote(r.Context(), w, store, id, noteChanges{Text: &result.Text})
+	}
+}
+
+func parseRevisionVars(vars map[string]string) (id, revision int, err error) {
+	id, err = strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, err
+	}
+	revision, err = strconv.Atoi(vars["revision"])
+	if err != nil {
+		return 0, 0, err
+	}
+	return id, revision, nil
+}
+
+// writeRevisionError responds to an error from NoteStore.Revision: 404 for
+// an unknown note or revision, a database error otherwise.
+func writeRevisionError(ctx context.Context, w http.ResponseWriter, err error) {
+	var message string
+	switch {
+	case errors.Is(err, errNoteNotFound):
+		message = "Note not found"
+	case errors.Is(err, errRevisionNotFound):
+		message = "Revision not found"
+	default:
+		writeDatabaseError(ctx, w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+	err = json.NewEncoder(w).Encode(newErrorResponse(ctx, message))
+	if err != nil {
+		return
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type postgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func newPostgresAPIKeyStore(db *sql.DB) *postgresAPIKeyStore {
+	return &postgresAPIKeyStore{db: db}
+}
+
+const apiKeyColumns = "id, name, prefix, scopes, created_at, last_used_at, revoked_at"
+
+func scanAPIKey(row interface{ Scan(...any) error }, extra ...any) (APIKey, error) {
+	var key APIKey
+	dest := append([]any{&key.ID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt}, extra...)
+	err := row.Scan(dest...)
+	return key, err
+}
+
+func (s *postgresAPIKeyStore) Create(ctx context.Context, name, prefix string, hash []byte, scopes []string) (APIKey, error) {
+	return scanAPIKey(s.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, prefix, key_hash, scopes)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+apiKeyColumns,
+		name, prefix, hash, pq.Array(scopes)))
+}
+
+func (s *postgresAPIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *postgresAPIKeyStore) Lookup(ctx context.Context, prefix string) (APIKey, []byte, error) {
+	var hash []byte
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+", key_hash FROM api_keys WHERE prefix = $1 AND revoked_at IS NULL",
+		prefix), &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, nil, errAPIKeyNotFound
+	}
+	return key, hash, err
+}
+
+func (s *postgresAPIKeyStore) Touch(ctx context.Context, id int, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE api_keys
+		SET last_used_at = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)`,
+		id, now, now.Add(-apiKeyTouchInterval))
+	return err
+}
+
+func (s *postgresAPIKeyStore) Revoke(ctx context.Context, id int) error {
+	var revoked bool
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE api_keys
+		SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1
+		RETURNING true`,
+		id).Scan(&revoked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errAPIKeyNotFound
+	}
+	return err
+}
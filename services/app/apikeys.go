@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/auth"
+)
+
+const maxAPIKeyNameLength = 100
+
+// APIKey is an API key as listed by the admin endpoints. The key itself is
+// only ever returned once, by createAPIKeyHandler.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type APIKeyCreateRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type APIKeyCreateResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// validateAPIKeyRequest returns a client-facing problem with req, or "".
+func validateAPIKeyRequest(req APIKeyCreateRequest) string {
+	if req.Name == "" {
+		return "Name field is required"
+	}
+	if utf8.RuneCountInString(req.Name) > maxAPIKeyNameLength {
+		return "Name must be at most " + strconv.Itoa(maxAPIKeyNameLength) + " characters"
+	}
+	if len(req.Scopes) == 0 {
+		return "At least one scope is required"
+	}
+	for _, scope := range req.Scopes {
+		if !auth.KnownScope(scope) {
+			return "Unknown scope " + strconv.Quote(scope)
+		}
+	}
+	return ""
+}
+
+func createAPIKeyHandler(keys APIKeyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req APIKeyCreateRequest
+		if !decodeRequestBody(w, r, &req) {
+			return
+		}
+
+		if problem := validateAPIKeyRequest(req); problem != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), problem))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		secret, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to generate API key", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Failed to generate API key"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		key, err := keys.Create(queryCtx, req.Name, prefix, hash, req.Scopes)
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		principal, _ := auth.FromContext(r.Context())
+		slog.InfoContext(r.Context(), "API key created", "id", key.ID, "prefix", key.Prefix, "scopes", key.Scopes, "by", principal.Subject)
+
+		w.WriteHeader(http.StatusCreated)
+		err = json.NewEncoder(w).Encode(APIKeyCreateResponse{APIKey: key, Key: secret})
+		if err != nil {
+			return
+		}
+	}
+}
+
+func listAPIKeysHandler(keys APIKeyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		list, err := keys.List(queryCtx)
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(list)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func revokeAPIKeyHandler(keys APIKeyStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		err = keys.Revoke(queryCtx, id)
+		if errors.Is(err, errAPIKeyNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "API key not found"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		principal, _ := auth.FromContext(r.Context())
+		slog.InfoContext(r.Context(), "API key revoked", "id", id, "by", principal.Subject)
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked"})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// printNewAPIKey creates a key from the command line and writes it to w. It
+// is how the first admin key is made, before anything can call the admin
+// endpoints.
+func printNewAPIKey(ctx context.Context, w io.Writer, keys APIKeyStore, name, scopes string) error {
+	req := APIKeyCreateRequest{Name: name, Scopes: strings.Split(scopes, ",")}
+	if problem := validateAPIKeyRequest(req); problem != "" {
+		return errors.New(problem)
+	}
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return err
+	}
+	key, err := keys.Create(ctx, req.Name, prefix, hash, req.Scopes)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("API key created", "id", key.ID, "prefix", key.Prefix, "scopes", key.Scopes, "by", "command line")
+	_, err = fmt.Fprintln(w, secret)
+	return err
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/auth"
+)
+
+// testAPIKeyStore checks the behaviour the middleware and admin handlers
+// rely on from every APIKeyStore.
+func testAPIKeyStore(t *testing.T, keys APIKeyStore) {
+	ctx := context.Background()
+
+	if _, _, err := keys.Lookup(ctx, "itb_00000000"); !errors.Is(err, errAPIKeyNotFound) {
+		t.Errorf("Lookup(unknown) error = %v, want errAPIKeyNotFound", err)
+	}
+	if err := keys.Revoke(ctx, 1_000_000); !errors.Is(err, errAPIKeyNotFound) {
+		t.Errorf("Revoke(unknown) error = %v, want errAPIKeyNotFound", err)
+	}
+
+	_, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := keys.Create(ctx, "deploy script", prefix, hash, []string{auth.ScopeNotesRead, auth.ScopeNotesWrite})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if created.ID == 0 || created.Prefix != prefix || len(created.Scopes) != 2 || created.CreatedAt.IsZero() || created.LastUsedAt != nil {
+		t.Errorf("Create() = %+v", created)
+	}
+
+	found, foundHash, err := keys.Lookup(ctx, prefix)
+	if err != nil || found.ID != created.ID || !bytes.Equal(foundHash, hash) {
+		t.Errorf("Lookup() = %+v, %x, %v", found, foundHash, err)
+	}
+
+	used := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	if err := keys.Touch(ctx, created.ID, used); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+	// Within apiKeyTouchInterval the first timestamp is kept.
+	if err := keys.Touch(ctx, created.ID, used.Add(apiKeyTouchInterval/2)); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+	list, err := keys.List(ctx)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("List() = %+v, %v", list, err)
+	}
+	if list[0].LastUsedAt == nil || !list[0].LastUsedAt.Equal(used) {
+		t.Errorf("last_used_at = %v, want %v", list[0].LastUsedAt, used)
+	}
+
+	if err := keys.Revoke(ctx, created.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+	if err := keys.Revoke(ctx, created.ID); err != nil {
+		t.Errorf("Revoke(revoked) error = %v, want nil", err)
+	}
+	if _, _, err := keys.Lookup(ctx, prefix); !errors.Is(err, errAPIKeyNotFound) {
+		t.Errorf("Lookup(revoked) error = %v, want errAPIKeyNotFound", err)
+	}
+	list, err = keys.List(ctx)
+	if err != nil || len(list) != 1 || list[0].RevokedAt == nil {
+		t.Errorf("List() after revoke = %+v, %v", list, err)
+	}
+}
+
+func TestMemoryAPIKeyStore(t *testing.T) {
+	testAPIKeyStore(t, newMemoryAPIKeyStore())
+}
+
+func TestPostgresAPIKeyStore(t *testing.T) {
+	testAPIKeyStore(t, newPostgresAPIKeyStore(testDB(t)))
+}
+
+func newAPIKeysRouter(keys APIKeyStore) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/admin/api-keys", createAPIKeyHandler(keys)).Methods("POST")
+	r.HandleFunc("/api/admin/api-keys", listAPIKeysHandler(keys)).Methods("GET")
+	r.HandleFunc("/api/admin/api-keys/{id}", revokeAPIKeyHandler(keys)).Methods("DELETE")
+	return r
+}
+
+func TestAPIKeyHandlers(t *testing.T) {
+	keys := newMemoryAPIKeyStore()
+	r := newAPIKeysRouter(keys)
+
+	created := decode[APIKeyCreateResponse](t, serve(t, r, "POST", "/api/admin/api-keys",
+		`{"name":"backup","scopes":["notes:read"]}`, http.StatusCreated))
+	if created.Name != "backup" || !strings.HasPrefix(created.Key, created.Prefix+"_") {
+		t.Errorf("created = %+v", created)
+	}
+	principal, err := authenticateAPIKey(context.Background(), keys, created.Key)
+	if err != nil || !principal.HasScope(auth.ScopeNotesRead) || principal.HasScope(auth.ScopeNotesWrite) {
+		t.Errorf("authenticateAPIKey() = %+v, %v", principal, err)
+	}
+
+	rr := serve(t, r, "GET", "/api/admin/api-keys", "", http.StatusOK)
+	if body := rr.Body.String(); strings.Contains(body, created.Key) || strings.Contains(body, "hash") {
+		t.Errorf("listing leaks key material: %s", body)
+	}
+	list := decode[[]APIKey](t, rr)
+	if len(list) != 1 || list[0].ID != created.ID || list[0].LastUsedAt == nil {
+		t.Errorf("list = %+v", list)
+	}
+
+	serve(t, r, "DELETE", "/api/admin/api-keys/1", "", http.StatusOK)
+	serve(t, r, "DELETE", "/api/admin/api-keys/99", "", http.StatusNotFound)
+	serve(t, r, "DELETE", "/api/admin/api-keys/abc", "", http.StatusBadRequest)
+	if _, err := authenticateAPIKey(context.Background(), keys, created.Key); !errors.Is(err, errAPIKeyNotFound) {
+		t.Errorf("revoked key authenticated: %v", err)
+	}
+}
+
+func TestCreateAPIKeyRejectsInvalidInput(t *testing.T) {
+	r := newAPIKeysRouter(newMemoryAPIKeyStore())
+
+	for _, body := range []string{
+		`{`,
+		`{"scopes":["notes:read"]}`,
+		`{"name":"x"}`,
+		`{"name":"x","scopes":["notes:delete"]}`,
+		`{"name":"` + strings.Repeat("x", maxAPIKeyNameLength+1) + `","scopes":["admin"]}`,
+	} {
+		serve(t, r, "POST", "/api/admin/api-keys", body, http.StatusBadRequest)
+	}
+
+	// The name limit counts characters, not bytes.
+	serve(t, r, "POST", "/api/admin/api-keys",
+		`{"name":"`+strings.Repeat("ж", maxAPIKeyNameLength)+`","scopes":["admin"]}`, http.StatusCreated)
+
+	rr := serve(t, r, "POST", "/api/admin/api-keys",
+		`{"name":"`+strings.Repeat("x", maxRequestBodyBytes)+`","scopes":["admin"]}`, http.StatusRequestEntityTooLarge)
+	if resp := decode[ErrorResponse](t, rr); resp.Error != "Request body too large" {
+		t.Errorf("error = %q", resp.Error)
+	}
+}
+
+func TestPrintNewAPIKey(t *testing.T) {
+	keys := newMemoryAPIKeyStore()
+
+	var out bytes.Buffer
+	if err := printNewAPIKey(context.Background(), &out, keys, "bootstrap", "admin,notes:read"); err != nil {
+		t.Fatalf("printNewAPIKey() error = %v", err)
+	}
+	principal, err := authenticateAPIKey(context.Background(), keys, strings.TrimSpace(out.String()))
+	if err != nil || !principal.HasScope(auth.ScopeAdmin) {
+		t.Errorf("printed key authenticates as %+v, %v", principal, err)
+	}
+
+	if err := printNewAPIKey(context.Background(), &out, keys, "bad", "root"); err == nil {
+		t.Error("unknown scope accepted")
+	}
+}
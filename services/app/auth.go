@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/auth"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// authMiddleware requires an API key in X-API-Key or a valid bearer token on
+// every path except publicPaths and CORS preflights, and stores the caller's
+// principal in the request context. A nil verifier accepts API keys only.
+func authMiddleware(verifier *auth.Verifier, keys APIKeyStore, publicPaths []string) mux.MiddlewareFunc {
+	public := make(map[string]bool, len(publicPaths))
+	for _, path := range publicPaths {
+		public[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if public[r.URL.Path] || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if key := r.Header.Get(apiKeyHeader); key != "" {
+				queryCtx, cancel := withQueryTimeout(r.Context())
+				defer cancel()
+
+				principal, err := authenticateAPIKey(queryCtx, keys, key)
+				if errors.Is(err, errAPIKeyNotFound) {
+					slog.InfoContext(r.Context(), "Rejected API key", "prefix", apiKeyLogPrefix(key))
+					w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+					writeAuthError(w, r, http.StatusUnauthorized, "Invalid API key")
+					return
+				}
+				if err != nil {
+					w.Header().Set("Content-Type", "application/json")
+					writeDatabaseError(queryCtx, w, err)
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+				return
+			}
+
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				writeAuthError(w, r, http.StatusUnauthorized, "Missing credentials")
+				return
+			}
+
+			principal, err := verifyToken(verifier, token)
+			if err != nil {
+				slog.InfoContext(r.Context(), "Rejected bearer token", "error", err)
+				message := "Invalid token"
+				if errors.Is(err, auth.ErrTokenExpired) {
+					message = "Token expired"
+				}
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="api", error="invalid_token", error_description=%q`, message))
+				writeAuthError(w, r, http.StatusUnauthorized, message)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func verifyToken(verifier *auth.Verifier, token string) (auth.Principal, error) {
+	if verifier == nil {
+		return auth.Principal{}, errors.New("bearer tokens are not configured")
+	}
+	return verifier.Verify(token)
+}
+
+// authenticateAPIKey returns the principal for key, or errAPIKeyNotFound
+// when the key is malformed, unknown, revoked or does not match its hash.
+func authenticateAPIKey(ctx context.Context, keys APIKeyStore, key string) (auth.Principal, error) {
+	prefix, ok := auth.ParseAPIKey(key)
+	if !ok {
+		return auth.Principal{}, errAPIKeyNotFound
+	}
+
+	stored, hash, err := keys.Lookup(ctx, prefix)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if !auth.CheckAPIKey(key, hash) {
+		return auth.Principal{}, errAPIKeyNotFound
+	}
+
+	// A failed last-used update must not fail the request.
+	if err := keys.Touch(ctx, stored.ID, time.Now()); err != nil {
+		slog.WarnContext(ctx, "Failed to record API key use", "prefix", prefix, "error", err)
+	}
+
+	return auth.Principal{Subject: auth.APIKeySubject(stored.Prefix), Scopes: stored.Scopes}, nil
+}
+
+// apiKeyLogPrefix returns the part of a presented key that is safe to log.
+func apiKeyLogPrefix(key string) string {
+	if prefix, ok := auth.ParseAPIKey(key); ok {
+		return prefix
+	}
+	return ""
+}
+
+// requireScope answers 403 unless the authenticated principal has scope. An
+// empty scope leaves next unguarded.
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	if scope == "" {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.FromContext(r.Context())
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeAuthError(w, r, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		if !principal.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="api", error="insufficient_scope", scope=%q`, scope))
+			writeAuthError(w, r, http.StatusForbidden, "Missing scope "+scope)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func writeAuthError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), message))
+	if err != nil {
+		return
+	}
+}
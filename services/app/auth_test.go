@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/auth"
+	"infrastructure-training-back/internal/config"
+)
+
+const testAuthSecret = "0123456789abcdef0123456789abcdef"
+
+func testToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testAuthSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func createTestAPIKey(t *testing.T, keys APIKeyStore, scopes ...string) string {
+	t.Helper()
+	key, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Create(context.Background(), "test", prefix, hash, scopes); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newAuthRouter(t *testing.T, keys APIKeyStore) *mux.Router {
+	t.Helper()
+	verifier, err := auth.NewVerifier(config.AuthConfig{HS256Secret: testAuthSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	whoami := func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.FromContext(r.Context())
+		_, _ = w.Write([]byte(principal.Subject))
+	}
+
+	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	r.Use(authMiddleware(verifier, keys, []string{"/health", "/api/ping"}))
+	r.HandleFunc("/health", healthHandler).Methods("GET")
+	r.HandleFunc("/api/ping", pingHandler).Methods("GET")
+	r.HandleFunc("/api/notes", requireScope(auth.ScopeNotesRead, whoami)).Methods("GET")
+	r.HandleFunc("/api/notes", requireScope(auth.ScopeNotesWrite, whoami)).Methods("POST")
+	r.HandleFunc("/api/notes/{id}", requireScope(auth.ScopeNotesWrite, whoami)).Methods("PUT", "DELETE")
+	return r
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	valid := testToken(t, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "scope": "notes:read notes:write"})
+	readOnly := testToken(t, jwt.MapClaims{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix(), "scope": "notes:read"})
+	unscoped := testToken(t, jwt.MapClaims{"sub": "carol", "exp": time.Now().Add(time.Hour).Unix()})
+	keys := newMemoryAPIKeyStore()
+	readKey := createTestAPIKey(t, keys, auth.ScopeNotesRead)
+	revokedKey := createTestAPIKey(t, keys, auth.ScopeNotesRead, auth.ScopeNotesWrite)
+	if err := keys.Revoke(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	readPrefix, _ := auth.ParseAPIKey(readKey)
+	forgedKey := readPrefix + revokedKey[len(readPrefix):]
+
+	// A token naming an API key as its subject would own that key's notes.
+	keySubject := testToken(t, jwt.MapClaims{"sub": "api-key:" + readPrefix, "exp": time.Now().Add(time.Hour).Unix(), "scope": "notes:read notes:write"})
+
+	expired := testToken(t, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})
+
+	tests := []struct {
+		name          string
+		method, path  string
+		authorization string
+		apiKey        string
+		status        int
+		body          string
+		error         string
+	}{
+		{"public health", "GET", "/health", "", "", http.StatusOK, "", ""},
+		{"public ping", "GET", "/api/ping", "", "", http.StatusOK, "", ""},
+		{"missing credentials", "GET", "/api/notes", "", "", http.StatusUnauthorized, "", "Missing credentials"},
+		{"wrong scheme", "GET", "/api/notes", "Basic " + valid, "", http.StatusUnauthorized, "", "Missing credentials"},
+		{"invalid token", "GET", "/api/notes", "Bearer garbage", "", http.StatusUnauthorized, "", "Invalid token"},
+		{"expired token", "GET", "/api/notes", "Bearer " + expired, "", http.StatusUnauthorized, "", "Token expired"},
+		{"valid token", "GET", "/api/notes", "Bearer " + valid, "", http.StatusOK, "alice", ""},
+		{"lowercase scheme", "GET", "/api/notes", "bearer " + valid, "", http.StatusOK, "alice", ""},
+		{"read-only token reads", "GET", "/api/notes", "Bearer " + readOnly, "", http.StatusOK, "bob", ""},
+		{"read-only token creates", "POST", "/api/notes", "Bearer " + readOnly, "", http.StatusForbidden, "", "Missing scope notes:write"},
+		{"read-only token replaces", "PUT", "/api/notes/1", "Bearer " + readOnly, "", http.StatusForbidden, "", "Missing scope notes:write"},
+		{"read-only token deletes", "DELETE", "/api/notes/1", "Bearer " + readOnly, "", http.StatusForbidden, "", "Missing scope notes:write"},
+		{"token without scopes", "GET", "/api/notes", "Bearer " + unscoped, "", http.StatusForbidden, "", "Missing scope notes:read"},
+		{"with scope", "POST", "/api/notes", "Bearer " + valid, "", http.StatusOK, "alice", ""},
+		{"api key", "GET", "/api/notes", "", readKey, http.StatusOK, "api-key:" + readPrefix, ""},
+		{"token posing as api key", "GET", "/api/notes", "Bearer " + keySubject, "", http.StatusUnauthorized, "", "Invalid token"},
+		{"api key missing scope", "POST", "/api/notes", "", readKey, http.StatusForbidden, "", "Missing scope notes:write"},
+		{"revoked api key", "GET", "/api/notes", "", revokedKey, http.StatusUnauthorized, "", "Invalid API key"},
+		{"api key with wrong secret", "GET", "/api/notes", "", forgedKey, http.StatusUnauthorized, "", "Invalid API key"},
+		{"malformed api key", "GET", "/api/notes", "", "hunter2", http.StatusUnauthorized, "", "Invalid API key"},
+		{"preflight skips auth", "OPTIONS", "/api/notes", "", "", http.StatusMethodNotAllowed, "", ""},
+	}
+
+	router := newAuthRouter(t, keys)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %q)", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.body != "" && rr.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", rr.Body.String(), tt.body)
+			}
+			if tt.error == "" {
+				return
+			}
+
+			if !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "Bearer ") {
+				t.Errorf("WWW-Authenticate = %q", rr.Header().Get("WWW-Authenticate"))
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode error body: %v", err)
+			}
+			if resp.Error != tt.error {
+				t.Errorf("error = %q, want %q", resp.Error, tt.error)
+			}
+			if resp.RequestID == "" || resp.RequestID != rr.Header().Get(requestIDHeader) {
+				t.Errorf("request_id = %q, header %q", resp.RequestID, rr.Header().Get(requestIDHeader))
+			}
+		})
+	}
+}
+
+func TestRequireScopeWithoutScope(t *testing.T) {
+	called := false
+	handler := requireScope("", func(http.ResponseWriter, *http.Request) { called = true })
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/notes", nil))
+	if !called {
+		t.Error("empty scope should not guard the handler")
+	}
+
+	rr := httptest.NewRecorder()
+	requireScope("notes:write", func(http.ResponseWriter, *http.Request) {
+		t.Error("handler called without a principal")
+	})(rr, httptest.NewRequest(http.MethodPost, "/api/notes", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rr.Code)
+	}
+}
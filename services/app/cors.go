@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/config"
+)
+
+// corsMethods are the methods a preflight may ask about. OPTIONS itself is
+// answered by preflightHandler and HEAD is not routed.
+var corsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// corsPolicy decides which origins may call the API and what the browser is
+// told about them.
+type corsPolicy struct {
+	allowAll bool
+	origins  map[string]bool
+	// wildcards holds https://*.example.com patterns split around the "*".
+	wildcards      []originPattern
+	allowedHeaders map[string]bool
+	exposedHeaders string
+	credentials    bool
+	maxAge         string
+}
+
+type originPattern struct {
+	prefix, suffix string
+}
+
+func newCORSPolicy(cfg config.CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		origins:        make(map[string]bool),
+		allowedHeaders: make(map[string]bool),
+		exposedHeaders: strings.Join(cfg.ExposedHeaders, ", "),
+		credentials:    cfg.AllowCredentials,
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			p.allowAll = true
+		case strings.Contains(origin, "://*."):
+			scheme, host, _ := strings.Cut(origin, "*")
+			p.wildcards = append(p.wildcards, originPattern{prefix: scheme, suffix: host})
+		default:
+			p.origins[origin] = true
+		}
+	}
+	for _, header := range cfg.AllowedHeaders {
+		p.allowedHeaders[strings.ToLower(header)] = true
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	return p
+}
+
+// allowOrigin reports whether origin may call the API. A wildcard pattern
+// matches one or more subdomain labels, never the bare domain.
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		sub, ok := strings.CutPrefix(origin, w.prefix)
+		if !ok {
+			continue
+		}
+		sub, ok = strings.CutSuffix(sub, w.suffix)
+		if ok && sub != "" && !strings.ContainsAny(sub, "/:@?#") && !strings.HasPrefix(sub, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// setAllowOrigin writes the headers shared by preflight and actual
+// responses for an allowed origin.
+func (p *corsPolicy) setAllowOrigin(h http.Header, origin string) {
+	if p.allowAll && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// varyOrigin reports whether responses differ by Origin, which caches must
+// be told through Vary.
+func (p *corsPolicy) varyOrigin() bool {
+	return !p.allowAll || p.credentials
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// corsMiddleware adds CORS headers to actual requests from allowed origins.
+// Preflights are left to preflightHandler.
+func corsMiddleware(policy *corsPolicy) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPreflight(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if policy.varyOrigin() {
+				w.Header().Add("Vary", "Origin")
+			}
+			if origin := r.Header.Get("Origin"); policy.allowOrigin(origin) {
+				policy.setAllowOrigin(w.Header(), origin)
+				if policy.exposedHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", policy.exposedHeaders)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// preflightHandler answers OPTIONS for every path. It is registered last on
+// router so that it only sees OPTIONS requests, and checks the requested
+// method against the routes registered for the path: a preflight for a
+// route that does not exist fails instead of promising access.
+func preflightHandler(router *mux.Router, policy *corsPolicy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		methods := routeMethods(router, r)
+		if len(methods) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Not found"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		allow := strings.Join(append(methods, http.MethodOptions), ", ")
+
+		if !isPreflight(r) {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+
+		origin := r.Header.Get("Origin")
+		if !policy.allowOrigin(origin) {
+			w.WriteHeader(http.StatusForbidden)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Origin not allowed"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		if method := r.Header.Get("Access-Control-Request-Method"); !slices.Contains(methods, method) {
+			h.Set("Allow", allow)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Method "+method+" not allowed"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		requested := requestedHeaders(r)
+		for _, header := range requested {
+			if !policy.allowedHeaders[header] {
+				w.WriteHeader(http.StatusForbidden)
+				err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Header "+header+" not allowed"))
+				if err != nil {
+					return
+				}
+				return
+			}
+		}
+
+		policy.setAllowOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(requested) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		if policy.maxAge != "" {
+			h.Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// routeMethods returns the methods router serves for the request's path.
+func routeMethods(router *mux.Router, r *http.Request) []string {
+	var methods []string
+	for _, method := range corsMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// requestedHeaders returns Access-Control-Request-Headers in lower case.
+func requestedHeaders(r *http.Request) []string {
+	var headers []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.ToLower(strings.TrimSpace(header)); header != "" {
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers
+}
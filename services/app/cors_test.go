@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/config"
+)
+
+func TestCORSPolicyAllowOrigin(t *testing.T) {
+	p := newCORSPolicy(config.CORSConfig{AllowedOrigins: []string{
+		"https://app.example.com",
+		"https://*.example.org",
+		"http://localhost:3000",
+	}})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://evil.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"https://example.org.evil.com", false},
+		{"https://a.example.org:8443", false},
+		{"http://a.example.org", false},
+		{"http://localhost:3000", true},
+		{"http://localhost:3001", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := p.allowOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func newCORSRouter(cfg config.CORSConfig) *mux.Router {
+	policy := newCORSPolicy(cfg)
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	r.Use(corsMiddleware(policy))
+	r.HandleFunc("/api/notes", ok).Methods("GET", "POST")
+	r.HandleFunc("/api/notes/{id}", ok).Methods("GET", "PUT", "DELETE")
+	r.Methods("OPTIONS").HandlerFunc(preflightHandler(r, policy))
+	return r
+}
+
+var testCORSConfig = config.CORSConfig{
+	AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+	AllowedHeaders:   []string{"Content-Type", "Authorization"},
+	ExposedHeaders:   []string{"X-Request-ID", "X-Cache"},
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+}
+
+func corsRequest(r http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	r := newCORSRouter(testCORSConfig)
+
+	rr := corsRequest(r, "GET", "/api/notes", map[string]string{"Origin": "https://team.example.org"})
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://team.example.org",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    "X-Request-ID, X-Cache",
+		"Vary":                             "Origin",
+	} {
+		if got := rr.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	// A disallowed origin still gets its response, without CORS headers, so
+	// the browser withholds it from the page.
+	rr = corsRequest(r, "GET", "/api/notes", map[string]string{"Origin": "https://evil.com"})
+	if rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "" || rr.Header().Get("Vary") != "Origin" {
+		t.Errorf("disallowed origin: code %d, headers %v", rr.Code, rr.Header())
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	r := newCORSRouter(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"Content-Type"}})
+
+	rr := corsRequest(r, "GET", "/api/notes", map[string]string{"Origin": "https://anywhere.test"})
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rr.Header().Get("Vary"); got != "" {
+		t.Errorf("Vary = %q, want none for a wildcard response", got)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r := newCORSRouter(testCORSConfig)
+	preflight := func(path, origin, method, headers string) *httptest.ResponseRecorder {
+		return corsRequest(r, "OPTIONS", path, map[string]string{
+			"Origin":                         origin,
+			"Access-Control-Request-Method":  method,
+			"Access-Control-Request-Headers": headers,
+		})
+	}
+
+	rr := preflight("/api/notes/7", "https://app.example.com", "PUT", "content-type, Authorization")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("allowed preflight: code %d, body %s", rr.Code, rr.Body.String())
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Methods":     "GET, PUT, DELETE",
+		"Access-Control-Allow-Headers":     "content-type, authorization",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if got := rr.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if vary := rr.Header().Values("Vary"); len(vary) != 3 {
+		t.Errorf("Vary = %v, want Origin and both request headers", vary)
+	}
+
+	for _, tt := range []struct {
+		name, path, origin, method, headers string
+		code                                int
+		error                               string
+	}{
+		{"unknown route", "/api/nope", "https://app.example.com", "GET", "", http.StatusNotFound, "Not found"},
+		{"method not routed", "/api/notes", "https://app.example.com", "DELETE", "", http.StatusMethodNotAllowed, "Method DELETE not allowed"},
+		{"origin not allowed", "/api/notes", "https://evil.com", "GET", "", http.StatusForbidden, "Origin not allowed"},
+		{"header not allowed", "/api/notes", "https://app.example.com", "POST", "X-Custom", http.StatusForbidden, "Header x-custom not allowed"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := preflight(tt.path, tt.origin, tt.method, tt.headers)
+			if rr.Code != tt.code {
+				t.Fatalf("code = %d, want %d", rr.Code, tt.code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+				t.Errorf("failed preflight allows origin %q", got)
+			}
+			if resp := decode[ErrorResponse](t, rr); resp.Error != tt.error {
+				t.Errorf("error = %q, want %q", resp.Error, tt.error)
+			}
+		})
+	}
+}
+
+func TestPlainOptions(t *testing.T) {
+	r := newCORSRouter(testCORSConfig)
+
+	rr := corsRequest(r, "OPTIONS", "/api/notes", nil)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("OPTIONS /api/notes: code %d, Allow %q", rr.Code, rr.Header().Get("Allow"))
+	}
+	if rr := corsRequest(r, "OPTIONS", "/nowhere", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("OPTIONS /nowhere: code %d, want 404", rr.Code)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"infrastructure-training-back/internal/config"
+)
+
+func okCheck(name string, required bool) healthCheck {
+	return healthCheck{name: name, required: required, run: func(context.Context) error { return nil }}
+}
+
+func failingCheck(name string, required bool) healthCheck {
+	return healthCheck{name: name, required: required, run: func(context.Context) error { return errors.New("connection refused") }}
+}
+
+func serveReadyz(t *testing.T, timeout time.Duration, checks ...healthCheck) (int, ReadinessReport) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	readyzHandler(timeout, checks...).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report ReadinessReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	return rr.Code, report
+}
+
+func TestReadyzAllHealthy(t *testing.T) {
+	code, report := serveReadyz(t, time.Second, okCheck("postgres", true), okCheck("redis", false))
+
+	if code != http.StatusOK || report.Status != checkOK {
+		t.Errorf("got %d %s, want 200 ok", code, report.Status)
+	}
+	if len(report.Checks) != 2 || report.Checks["postgres"].Status != checkOK {
+		t.Errorf("Checks = %+v", report.Checks)
+	}
+}
+
+func TestReadyzOptionalFailureDegrades(t *testing.T) {
+	code, report := serveReadyz(t, time.Second, okCheck("postgres", true), failingCheck("redis", false))
+
+	if code != http.StatusOK || report.Status != checkDegraded {
+		t.Errorf("got %d %s, want 200 degraded", code, report.Status)
+	}
+	if redis := report.Checks["redis"]; redis.Status != checkDegraded || redis.Error != "connection refused" {
+		t.Errorf("redis check = %+v", redis)
+	}
+}
+
+func TestReadyzRequiredFailureIsUnavailable(t *testing.T) {
+	code, report := serveReadyz(t, time.Second, failingCheck("postgres", true), failingCheck("redis", false))
+
+	if code != http.StatusServiceUnavailable || report.Status != checkFailed {
+		t.Errorf("got %d %s, want 503 fail", code, report.Status)
+	}
+	if report.Checks["postgres"].Status != checkFailed {
+		t.Errorf("postgres check = %+v", report.Checks["postgres"])
+	}
+}
+
+func TestReadyzTimesOutHungCheck(t *testing.T) {
+	hung := healthCheck{name: "postgres", required: true, run: func(context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}}
+
+	start := time.Now()
+	code, report := serveReadyz(t, 50*time.Millisecond, hung)
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("readyz took %v, want it bounded by the check timeout", elapsed)
+	}
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("code = %d, want 503", code)
+	}
+	if got := report.Checks["postgres"]; got.Error != context.DeadlineExceeded.Error() || got.LatencyMS < 50 {
+		t.Errorf("postgres check = %+v", got)
+	}
+}
+
+func TestRedisCheckWithoutClient(t *testing.T) {
+	check := redisCheck(nil, config.RedisConfig{})
+	if check.required || check.run(context.Background()) == nil {
+		t.Errorf("redisCheck(nil) = required %v, want optional and failing", check.required)
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// API keys look like itb_0123abcd_<43 base64url characters>. The part up to
+// the second underscore is the prefix: it is stored in clear to find the key
+// and to show it in listings. Only a SHA-256 hash of the whole key is
+// stored; the secret part has 256 bits of entropy, so a slow hash would add
+// nothing.
+const (
+	apiKeyScheme    = "itb_"
+	apiKeyPrefixLen = len(apiKeyScheme) + 8
+	apiKeySecretLen = 43
+)
+
+// apiKeySubjectPrefix starts the principal subject of every API key.
+const apiKeySubjectPrefix = "api-key:"
+
+// APIKeySubject is the principal subject of the API key with prefix. Bearer
+// tokens may not use subjects of this form, so a token can never act as, and
+// own the notes of, an API key.
+func APIKeySubject(prefix string) string {
+	return apiKeySubjectPrefix + prefix
+}
+
+// NewAPIKey returns a fresh key, its prefix and the hash to store.
+func NewAPIKey() (key, prefix string, hash []byte, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", nil, err
+	}
+
+	prefix = apiKeyScheme + hex.EncodeToString(id)
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// ParseAPIKey returns the prefix of key, or false if key is not shaped like
+// one returned by NewAPIKey.
+func ParseAPIKey(key string) (string, bool) {
+	if len(key) != apiKeyPrefixLen+1+apiKeySecretLen || !strings.HasPrefix(key, apiKeyScheme) || key[apiKeyPrefixLen] != '_' {
+		return "", false
+	}
+	return key[:apiKeyPrefixLen], true
+}
+
+func HashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// CheckAPIKey reports whether key hashes to hash, in constant time.
+func CheckAPIKey(key string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(HashAPIKey(key), hash) == 1
+}
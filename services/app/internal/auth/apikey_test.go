@@ -0,0 +1,44 @@
+package auth
+
+import "testing"
+
+func TestAPIKeyRoundTrip(t *testing.T) {
+	key, prefix, hash, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, ok := ParseAPIKey(key)
+	if !ok || parsed != prefix {
+		t.Fatalf("ParseAPIKey(%q) = %q, %v, want %q", key, parsed, ok, prefix)
+	}
+	if !CheckAPIKey(key, hash) {
+		t.Error("CheckAPIKey rejected the generated key")
+	}
+	modified := []byte(key)
+	modified[len(modified)-1] ^= 1
+	if CheckAPIKey(string(modified), hash) {
+		t.Error("CheckAPIKey accepted a modified key")
+	}
+
+	other, _, _, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key {
+		t.Error("NewAPIKey returned the same key twice")
+	}
+}
+
+func TestParseAPIKeyRejectsMalformed(t *testing.T) {
+	key, _, _, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{"", "itb_", key[:len(key)-1], key + "x", "xyz" + key[3:], key[:12] + "-" + key[13:]} {
+		if _, ok := ParseAPIKey(bad); ok {
+			t.Errorf("ParseAPIKey(%q) accepted", bad)
+		}
+	}
+}
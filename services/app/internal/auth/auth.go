@@ -0,0 +1,46 @@
+// Package auth verifies bearer tokens and API keys and carries the authenticated
+// principal through request contexts.
+package auth
+
+import (
+	"context"
+	"slices"
+)
+
+// Scopes understood by the API. Routes name the scope they need in main.go.
+const (
+	ScopeNotesRead  = "notes:read"
+	ScopeNotesWrite = "notes:write"
+	ScopeAdmin      = "admin"
+)
+
+// KnownScope reports whether scope is one of the scopes above.
+func KnownScope(scope string) bool {
+	switch scope {
+	case ScopeNotesRead, ScopeNotesWrite, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// Principal is the caller a request was authenticated as.
+type Principal struct {
+	Subject string
+	Scopes  []string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored by WithPrincipal, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"infrastructure-training-back/internal/config"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, c jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "user-1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "notes:read notes:write",
+	}
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func publicKeyPEM(t *testing.T, key *rsa.PrivateKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestVerifyHS256(t *testing.T) {
+	v, err := NewVerifier(config.AuthConfig{HS256Secret: testSecret, Issuer: "issuer", Audience: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := validClaims()
+	c["iss"] = "issuer"
+	c["aud"] = "api"
+	p, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", c))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if p.Subject != "user-1" || !slices.Equal(p.Scopes, []string{"notes:read", "notes:write"}) {
+		t.Errorf("principal = %+v", p)
+	}
+	if !p.HasScope("notes:write") || p.HasScope("admin") {
+		t.Errorf("HasScope mismatch for %v", p.Scopes)
+	}
+}
+
+func TestVerifyScopes(t *testing.T) {
+	v, err := NewVerifier(config.AuthConfig{HS256Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   []string
+	}{
+		{"no scopes", jwt.MapClaims{}, nil},
+		{"read only", jwt.MapClaims{"scope": "notes:read"}, []string{ScopeNotesRead}},
+		{"scp string", jwt.MapClaims{"scp": "notes:read notes:write"}, []string{ScopeNotesRead, ScopeNotesWrite}},
+		{"scp list", jwt.MapClaims{"scp": []string{"admin", "notes:read"}}, []string{ScopeAdmin, ScopeNotesRead}},
+		{"scope and scp merged", jwt.MapClaims{"scope": "notes:read", "scp": []string{"notes:read", "admin"}}, []string{ScopeNotesRead, ScopeAdmin}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := jwt.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+			for k, val := range tt.claims {
+				c[k] = val
+			}
+			p, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", c))
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !slices.Equal(p.Scopes, tt.want) {
+				t.Errorf("scopes = %v, want %v", p.Scopes, tt.want)
+			}
+		})
+	}
+
+	c := validClaims()
+	c["scope"] = 42
+	if _, err := v.Verify(sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", c)); err == nil {
+		t.Error("Verify accepted a numeric scope claim")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	v, err := NewVerifier(config.AuthConfig{HS256Secret: testSecret, Issuer: "issuer", Audience: "api", Leeway: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := func() jwt.MapClaims {
+		c := validClaims()
+		c["iss"] = "issuer"
+		c["aud"] = "api"
+		return c
+	}
+	hs := func(c jwt.MapClaims) string { return sign(t, jwt.SigningMethodHS256, []byte(testSecret), "", c) }
+
+	tests := []struct {
+		name  string
+		token func() string
+		want  error
+	}{
+		{"expired", func() string {
+			c := base()
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+			return hs(c)
+		}, ErrTokenExpired},
+		{"missing exp", func() string {
+			c := base()
+			delete(c, "exp")
+			return hs(c)
+		}, jwt.ErrTokenRequiredClaimMissing},
+		{"not yet valid", func() string {
+			c := base()
+			c["nbf"] = time.Now().Add(time.Minute).Unix()
+			return hs(c)
+		}, jwt.ErrTokenNotValidYet},
+		{"wrong issuer", func() string {
+			c := base()
+			c["iss"] = "someone-else"
+			return hs(c)
+		}, jwt.ErrTokenInvalidIssuer},
+		{"wrong audience", func() string {
+			c := base()
+			c["aud"] = "other"
+			return hs(c)
+		}, jwt.ErrTokenInvalidAudience},
+		{"wrong secret", func() string {
+			return sign(t, jwt.SigningMethodHS256, []byte("another-secret-another-secret-xx"), "", base())
+		}, jwt.ErrTokenSignatureInvalid},
+		{"alg none", func() string {
+			return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", base())
+		}, jwt.ErrTokenSignatureInvalid},
+		{"missing sub", func() string {
+			c := base()
+			delete(c, "sub")
+			return hs(c)
+		}, nil},
+		{"api key subject", func() string {
+			c := base()
+			c["sub"] = "api-key:itb_0123abcd"
+			return hs(c)
+		}, nil},
+		{"garbage", func() string { return "not.a.token" }, jwt.ErrTokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(tt.token())
+			if err == nil {
+				t.Fatal("Verify succeeded, want error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRS256(t *testing.T) {
+	key := newRSAKey(t)
+	v, err := NewVerifier(config.AuthConfig{RS256KeyFile: writeFile(t, "jwt.pub", publicKeyPEM(t, key))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Verify(sign(t, jwt.SigningMethodRS256, key, "", validClaims())); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// A token signed with HS256 over the public key must not pass: only
+	// RS256 is accepted when no HMAC key is configured.
+	forged := sign(t, jwt.SigningMethodHS256, publicKeyPEM(t, key), "", validClaims())
+	if _, err := v.Verify(forged); err == nil {
+		t.Error("HS256 token signed with the RSA public key was accepted")
+	}
+
+	other := newRSAKey(t)
+	if _, err := v.Verify(sign(t, jwt.SigningMethodRS256, other, "", validClaims())); err == nil {
+		t.Error("token signed by another RSA key was accepted")
+	}
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	first, second := newRSAKey(t), newRSAKey(t)
+	b64 := base64.RawURLEncoding.EncodeToString
+	rsaJWK := func(kid string, key *rsa.PrivateKey) map[string]string {
+		return map[string]string{
+			"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+			"n": b64(key.N.Bytes()),
+			"e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}
+	}
+	data, err := json.Marshal(map[string]any{"keys": []any{
+		rsaJWK("first", first),
+		rsaJWK("second", second),
+		map[string]string{"kty": "oct", "kid": "shared", "alg": "HS256", "k": b64([]byte(testSecret))},
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": b64(first.N.Bytes()), "e": "AQAB"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := NewVerifier(config.AuthConfig{JWKSFile: writeFile(t, "jwks.json", data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"first kid", sign(t, jwt.SigningMethodRS256, first, "first", validClaims()), true},
+		{"second kid", sign(t, jwt.SigningMethodRS256, second, "second", validClaims()), true},
+		{"oct kid", sign(t, jwt.SigningMethodHS256, []byte(testSecret), "shared", validClaims()), true},
+		{"kid of another key", sign(t, jwt.SigningMethodRS256, first, "second", validClaims()), false},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, first, "missing", validClaims()), false},
+		{"encryption key", sign(t, jwt.SigningMethodRS256, first, "enc", validClaims()), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := v.Verify(tc.token)
+			if (err == nil) != tc.ok {
+				t.Errorf("Verify error = %v, want ok = %v", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestNewVerifierErrors(t *testing.T) {
+	if _, err := NewVerifier(config.AuthConfig{}); err == nil {
+		t.Error("no keys: want error")
+	}
+	if _, err := NewVerifier(config.AuthConfig{RS256KeyFile: writeFile(t, "bad.pem", []byte("nope"))}); err == nil {
+		t.Error("bad PEM: want error")
+	}
+	if _, err := NewVerifier(config.AuthConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("missing JWKS: want error")
+	}
+}
+
+func TestNewVerifierRejectsWeakKeys(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	for name, key := range map[string]map[string]string{
+		"short oct": {"kty": "oct", "kid": "short", "k": b64([]byte("0123456789abcdef0123456789abcde"))},
+		"1024-bit RSA": {
+			"kty": "RSA", "kid": "weak",
+			"n": b64(weak.N.Bytes()),
+			"e": b64(big.NewInt(int64(weak.E)).Bytes()),
+		},
+	} {
+		data, err := json.Marshal(map[string]any{"keys": []any{key}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewVerifier(config.AuthConfig{JWKSFile: writeFile(t, "jwks.json", data)}); err == nil {
+			t.Errorf("%s in JWKS: want error", name)
+		}
+	}
+
+	if _, err := NewVerifier(config.AuthConfig{RS256KeyFile: writeFile(t, "weak.pem", publicKeyPEM(t, weak))}); err == nil {
+		t.Error("1024-bit RS256 key file: want error")
+	}
+}
@@ -0,0 +1,100 @@
+// Package database opens the PostgreSQL pool shared by the service and
+// cmd/migrate.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+
+	"github.com/XSAM/otelsql"
+	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+
+	"infrastructure-training-back/internal/config"
+)
+
+// maxPingTimeout caps a single connection attempt so one hung dial cannot
+// eat the whole retry budget.
+const maxPingTimeout = 5 * time.Second
+
+// Open configures the connection pool and pings the database, retrying with
+// exponential backoff until it answers or cfg.ConnectTimeout runs out.
+func Open(ctx context.Context, cfg config.DatabaseConfig) (*sql.DB, error) {
+	// otelsql records a span for every query, exec and transaction under
+	// the span in the caller's context.
+	db, err := otelsql.Open("postgres", cfg.DSN(),
+		otelsql.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err = connect(ctx, db, cfg); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	slog.Info("Database connected successfully",
+		"target", cfg.Target(),
+		"max_open_conns", cfg.MaxOpenConns,
+		"max_idle_conns", cfg.MaxIdleConns,
+	)
+
+	return db, nil
+}
+
+func connect(ctx context.Context, db *sql.DB, cfg config.DatabaseConfig) error {
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+
+	for attempt := 1; ; attempt++ {
+		pingTimeout := min(time.Until(deadline), maxPingTimeout)
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		delay := backoff(attempt, cfg.ConnectBackoff, cfg.ConnectMaxBackoff)
+		if ctx.Err() != nil || time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("failed to ping database after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("Database not ready, retrying",
+			"attempt", attempt,
+			"retry_in", delay,
+			"error", err,
+		)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to ping database after %d attempts: %w", attempt, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt: initial doubled per
+// attempt, capped at maxDelay, with up to 20% jitter taken off so replicas
+// starting together do not retry in lockstep.
+func backoff(attempt int, initial, maxDelay time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	return delay - time.Duration(rand.Int64N(int64(delay)/5+1))
+}
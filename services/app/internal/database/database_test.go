@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"infrastructure-training-back/internal/config"
+)
+
+func TestBackoffDoublesUpToMax(t *testing.T) {
+	initial, maxDelay := 100*time.Millisecond, time.Second
+
+	for _, tt := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	} {
+		got := backoff(tt.attempt, initial, maxDelay)
+		if got > tt.want || got < tt.want*4/5 {
+			t.Errorf("backoff(%d) = %v, want within 20%% below %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// closedPort returns a local address nothing is listening on.
+func closedPort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestOpenGivesUpAfterConnectTimeout(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Host = "127.0.0.1"
+	cfg.Port = closedPort(t)
+	cfg.Password = "unused"
+	cfg.ConnectTimeout = 400 * time.Millisecond
+	cfg.ConnectBackoff = 50 * time.Millisecond
+	cfg.ConnectMaxBackoff = 100 * time.Millisecond
+
+	start := time.Now()
+	db, err := Open(context.Background(), cfg)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		db.Close()
+		t.Fatal("Open() succeeded against a closed port")
+	}
+	if !strings.Contains(err.Error(), "attempts") || strings.Contains(err.Error(), "after 1 attempts") {
+		t.Errorf("Open() error = %v, want several attempts", err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Open() took %v, want it bounded by the connect timeout", elapsed)
+	}
+}
+
+func TestOpenStopsWhenContextIsCancelled(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Host = "127.0.0.1"
+	cfg.Port = closedPort(t)
+	cfg.Password = "unused"
+	cfg.ConnectTimeout = time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := Open(ctx, cfg); err == nil {
+		t.Fatal("Open() succeeded against a closed port")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Open() took %v after the context expired", elapsed)
+	}
+}
+
+func TestOpenAppliesPoolSettings(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	cfg := config.Default().Database
+	cfg.URL = dsn
+	cfg.MaxOpenConns = 3
+
+	db, err := Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	if got := db.Stats().MaxOpenConnections; got != 3 {
+		t.Errorf("MaxOpenConnections = %d, want 3", got)
+	}
+}
@@ -0,0 +1,159 @@
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// testDSN returns a DSN for a fresh schema in the database named by
+// TEST_DATABASE_URL, skipping the test when it is not set.
+func testDSN(t *testing.T) string {
+	t.Helper()
+
+	base := os.Getenv("TEST_DATABASE_URL")
+	if base == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+	schema := "migrate_test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func testMigrations() []Migration {
+	scripts := []struct{ name, sql string }{
+		// The sleep widens the window in which an unlocked runner would race.
+		{"001_create_runs.sql", "CREATE TABLE runs (id SERIAL PRIMARY KEY); SELECT pg_sleep(0.2);"},
+		{"002_record_run.sql", "INSERT INTO runs DEFAULT VALUES;"},
+	}
+
+	migrations := make([]Migration, len(scripts))
+	for i, s := range scripts {
+		migrations[i] = Migration{Name: s.name, UpSQL: s.sql, Checksum: Checksum([]byte(s.sql))}
+	}
+	return migrations
+}
+
+func TestUpConcurrentRunnersApplyEachMigrationOnce(t *testing.T) {
+	dsn := testDSN(t)
+
+	const runners = 8
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		errs  = make(chan error, runners)
+	)
+	for i := 0; i < runners; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			db, err := sql.Open("postgres", dsn)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer db.Close()
+
+			<-start
+			errs <- New(db, testMigrations()).Up(context.Background())
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Up() error = %v", err)
+		}
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var runs, recorded int
+	if err := db.QueryRow("SELECT COUNT(*) FROM runs").Scan(&runs); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM migrations").Scan(&recorded); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Errorf("002_record_run.sql ran %d times, want exactly once", runs)
+	}
+	if recorded != 2 {
+		t.Errorf("migrations table has %d rows, want 2", recorded)
+	}
+}
+
+func TestUpTimesOutWaitingForLock(t *testing.T) {
+	dsn := testDSN(t)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	holder, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	if _, err := holder.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		t.Fatal(err)
+	}
+	defer holder.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+
+	m := New(db, testMigrations())
+	m.LockTimeout = 500 * time.Millisecond
+
+	err = m.Up(ctx)
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Up() error = %v, want %v", err, ErrLockTimeout)
+	}
+	if !strings.Contains(err.Error(), "held by pid") {
+		t.Errorf("Up() error %q does not name the lock holder", err)
+	}
+}
@@ -0,0 +1,65 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPendingListsUnappliedMigrations(t *testing.T) {
+	dsn := testDSN(t)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	m := New(db, testMigrations())
+
+	if _, err := m.Pending(ctx); err == nil {
+		t.Error("Pending() before the migrations table exists: error = nil, want an error")
+	}
+
+	if err := New(db, testMigrations()[:1]).Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatalf("Pending() error = %v", err)
+	}
+	if want := []string{"002_record_run.sql"}; !slices.Equal(pending, want) {
+		t.Errorf("Pending() = %v, want %v", pending, want)
+	}
+}
+
+func TestUpCallsObserve(t *testing.T) {
+	dsn := testDSN(t)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var observed []string
+	m := New(db, testMigrations())
+	m.Observe = func(name, direction string, _ time.Duration, err error) {
+		if err != nil {
+			t.Errorf("Observe(%s) error = %v", name, err)
+		}
+		observed = append(observed, direction+" "+name)
+	}
+
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	if want := []string{"up 001_create_runs.sql", "up 002_record_run.sql"}; !slices.Equal(observed, want) {
+		t.Errorf("observed = %v, want %v", observed, want)
+	}
+}
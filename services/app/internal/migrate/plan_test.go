@@ -0,0 +1,93 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestPlanUpRollsBackAndReportsFailures(t *testing.T) {
+	dsn := testDSN(t)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	scripts := []struct{ name, sql string }{
+		{"001_create.sql", "CREATE TABLE planned (id INT);"},
+		{"002_broken.sql", "INSERT INTO missing_table VALUES (1);"},
+		{"003_after.sql", "INSERT INTO planned VALUES (1);"},
+	}
+	migrations := make([]Migration, len(scripts))
+	for i, s := range scripts {
+		migrations[i] = Migration{Name: s.name, UpSQL: s.sql, Checksum: Checksum([]byte(s.sql))}
+	}
+
+	plan, err := New(db, migrations).PlanUp(context.Background())
+	if err != nil {
+		t.Fatalf("PlanUp() error = %v", err)
+	}
+
+	if plan.OK {
+		t.Error("plan.OK = true, want false")
+	}
+	want := []string{StepOK, StepFailed, StepSkipped}
+	for i, step := range plan.Steps {
+		if step.Status != want[i] {
+			t.Errorf("step %s status = %s, want %s", step.Name, step.Status, want[i])
+		}
+	}
+	if plan.Steps[1].Error == "" {
+		t.Error("failed step has no error message")
+	}
+
+	// Nothing, not even the migrations table, may survive a dry run.
+	var tables int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name IN ('planned', 'migrations')`).Scan(&tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("dry run left %d tables behind", tables)
+	}
+}
+
+func TestPlanDownValidatesDownScripts(t *testing.T) {
+	dsn := testDSN(t)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	up := "CREATE TABLE reversible (id INT);"
+	migrations := []Migration{
+		{Name: "001_reversible.up.sql", UpSQL: up, DownSQL: "DROP TABLE reversible;", Checksum: Checksum([]byte(up))},
+	}
+	m := New(db, migrations)
+	ctx := context.Background()
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	plan, err := m.PlanDown(ctx, 1)
+	if err != nil {
+		t.Fatalf("PlanDown() error = %v", err)
+	}
+	if !plan.OK || len(plan.Steps) != 1 || plan.Steps[0].SQL != "DROP TABLE reversible;" {
+		t.Errorf("PlanDown() = %+v", plan)
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT to_regclass('reversible') IS NOT NULL").Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if !exists {
+		t.Error("dry run dropped the table")
+	}
+}
@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+const goSuffix = ".go"
+
+// GoFunc is the body of a Go migration. It runs inside the same transaction
+// that records the migration, so returning an error rolls both back.
+type GoFunc func(ctx context.Context, tx *sql.Tx) error
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Migration)
+)
+
+// Register adds a Go migration, typically from an init function in the
+// migrations package. id orders it among the SQL files ("003_backfill" runs
+// after "002_x.up.sql") and it is recorded as "<id>.go". down may be nil for
+// an irreversible migration. Register panics if id is registered twice.
+func Register(id string, up, down GoFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if up == nil {
+		panic("migrate: Register up function is nil for " + id)
+	}
+	if _, dup := registry[id]; dup {
+		panic("migrate: Register called twice for " + id)
+	}
+
+	registry[id] = Migration{Name: id + goSuffix, UpFunc: up, DownFunc: down}
+}
+
+func registered() map[string]Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	migrations := make(map[string]Migration, len(registry))
+	for id, m := range registry {
+		migrations[id] = m
+	}
+	return migrations
+}
+
+func (m Migration) run(ctx context.Context, tx *sql.Tx, direction string) error {
+	if direction == DirectionDown {
+		if m.DownFunc != nil {
+			return m.DownFunc(ctx, tx)
+		}
+		_, err := tx.ExecContext(ctx, m.DownSQL)
+		return err
+	}
+
+	if m.UpFunc != nil {
+		return m.UpFunc(ctx, tx)
+	}
+	_, err := tx.ExecContext(ctx, m.UpSQL)
+	return err
+}
+
+func (m Migration) downChecksum() string {
+	if m.IsGo() {
+		return ""
+	}
+	return Checksum([]byte(m.DownSQL))
+}
@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+)
+
+func unregister(id string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	delete(registry, id)
+}
+
+func noopGoFunc(context.Context, *sql.Tx) error { return nil }
+
+func TestLoadOrdersGoMigrationsAmongSQLFiles(t *testing.T) {
+	Register("002_backfill", noopGoFunc, nil)
+	t.Cleanup(func() { unregister("002_backfill") })
+
+	fsys := fstest.MapFS{
+		"001_create.sql":   {Data: []byte("SELECT 1;")},
+		"003_index.up.sql": {Data: []byte("SELECT 3;")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := []struct{ name, kind string }{
+		{"001_create.sql", "sql"},
+		{"002_backfill.go", "go"},
+		{"003_index.up.sql", "sql"},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("Load() returned %d migrations, want %d", len(migrations), len(want))
+	}
+	for i, w := range want {
+		if migrations[i].Name != w.name || migrations[i].Kind() != w.kind {
+			t.Errorf("migration %d = %s [%s], want %s [%s]",
+				i, migrations[i].Name, migrations[i].Kind(), w.name, w.kind)
+		}
+	}
+	if migrations[1].ID() != "002_backfill" || migrations[1].Reversible() {
+		t.Errorf("Go migration ID = %s, Reversible = %v", migrations[1].ID(), migrations[1].Reversible())
+	}
+}
+
+func TestLoadRejectsGoMigrationClashingWithSQLFile(t *testing.T) {
+	Register("001_create", noopGoFunc, noopGoFunc)
+	t.Cleanup(func() { unregister("001_create") })
+
+	fsys := fstest.MapFS{"001_create.sql": {Data: []byte("SELECT 1;")}}
+
+	if _, err := Load(fsys); err == nil {
+		t.Error("Load() expected error for clashing migration ids")
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	Register("009_once", noopGoFunc, nil)
+	t.Cleanup(func() { unregister("009_once") })
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Register() did not panic on duplicate id")
+		}
+	}()
+	Register("009_once", noopGoFunc, nil)
+}
+
+func TestUpAppliesGoMigration(t *testing.T) {
+	dsn := testDSN(t)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	backfill := func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "INSERT INTO items (name) VALUES ('backfilled')")
+		return err
+	}
+	migrations := []Migration{
+		{Name: "001_items.sql", UpSQL: "CREATE TABLE items (name TEXT);", Checksum: Checksum([]byte("CREATE TABLE items (name TEXT);"))},
+		{Name: "002_backfill.go", UpFunc: backfill},
+	}
+
+	m := New(db, migrations)
+	ctx := context.Background()
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	// A second run must neither re-apply nor flag the Go migration as drifted.
+	if err := m.Up(ctx); err != nil {
+		t.Fatalf("second Up() error = %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM items").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Go migration ran %d times, want once", count)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(statuses) != 2 || !statuses[1].Applied || statuses[1].Kind != "go" {
+		t.Errorf("Status() = %+v", statuses)
+	}
+}
@@ -0,0 +1,135 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+const (
+	upSuffix   = ".up.sql"
+	downSuffix = ".down.sql"
+	sqlSuffix  = ".sql"
+)
+
+// Migration is a single schema change, either SQL scripts or registered Go
+// functions. Name is the file name of the up script (or "<id>.go") and is
+// what gets recorded in the migrations table, so plain "001_x.sql" files
+// keep the names they were originally applied under.
+type Migration struct {
+	Name     string
+	UpSQL    string
+	DownSQL  string
+	Checksum string
+
+	UpFunc   GoFunc
+	DownFunc GoFunc
+}
+
+// IsGo reports whether the migration is a registered Go function.
+func (m Migration) IsGo() bool {
+	return m.UpFunc != nil
+}
+
+// Kind is "go" for Go migrations and "sql" otherwise.
+func (m Migration) Kind() string {
+	if m.IsGo() {
+		return "go"
+	}
+	return "sql"
+}
+
+// Reversible reports whether the migration can be reverted.
+func (m Migration) Reversible() bool {
+	return m.DownSQL != "" || m.DownFunc != nil
+}
+
+// ID is the name without the .sql/.up.sql/.go suffix, e.g.
+// "002_add_notes_search".
+func (m Migration) ID() string {
+	return migrationID(m.Name)
+}
+
+func migrationID(name string) string {
+	if id, ok := strings.CutSuffix(name, upSuffix); ok {
+		return id
+	}
+	if id, ok := strings.CutSuffix(name, goSuffix); ok {
+		return id
+	}
+	return strings.TrimSuffix(name, sqlSuffix)
+}
+
+// Load reads migrations from the root of fsys and merges them with the
+// registered Go migrations. An up script is either "<id>.up.sql" or a plain
+// "<id>.sql"; its optional down script is "<id>.down.sql". The result is
+// sorted by name.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	byID := make(map[string]*Migration)
+	downs := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, sqlSuffix) {
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", name, err)
+		}
+
+		if id, ok := strings.CutSuffix(name, downSuffix); ok {
+			downs[id] = string(content)
+			continue
+		}
+
+		id := migrationID(name)
+		if existing, ok := byID[id]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same id %s", existing.Name, name, id)
+		}
+		byID[id] = &Migration{
+			Name:     name,
+			UpSQL:    string(content),
+			Checksum: Checksum(content),
+		}
+	}
+
+	for id, down := range downs {
+		m, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("down migration %s%s has no matching up migration", id, downSuffix)
+		}
+		m.DownSQL = down
+	}
+
+	for id, m := range registered() {
+		if existing, ok := byID[id]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same id %s", existing.Name, m.Name, id)
+		}
+		byID[id] = &m
+	}
+
+	migrations := make([]Migration, 0, len(byID))
+	for _, m := range byID {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
+
+	return migrations, nil
+}
+
+// Checksum returns the hex encoded SHA-256 of a migration script.
+func Checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
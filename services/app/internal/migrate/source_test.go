@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadPairsUpAndDownScripts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001_create_notes_table.sql":      {Data: []byte("CREATE TABLE notes ();")},
+		"001_create_notes_table.down.sql": {Data: []byte("DROP TABLE notes;")},
+		"002_add_index.up.sql":            {Data: []byte("CREATE INDEX i ON notes (id);")},
+		"002_add_index.down.sql":          {Data: []byte("DROP INDEX i;")},
+		"003_irreversible.up.sql":         {Data: []byte("SELECT 1;")},
+		"README.md":                       {Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	want := []struct {
+		name       string
+		id         string
+		reversible bool
+	}{
+		{"001_create_notes_table.sql", "001_create_notes_table", true},
+		{"002_add_index.up.sql", "002_add_index", true},
+		{"003_irreversible.up.sql", "003_irreversible", false},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("Load() returned %d migrations, want %d", len(migrations), len(want))
+	}
+	for i, w := range want {
+		m := migrations[i]
+		if m.Name != w.name || m.ID() != w.id || m.Reversible() != w.reversible {
+			t.Errorf("migration %d = {%s %s %v}, want {%s %s %v}",
+				i, m.Name, m.ID(), m.Reversible(), w.name, w.id, w.reversible)
+		}
+	}
+
+	if migrations[1].DownSQL != "DROP INDEX i;" {
+		t.Errorf("DownSQL = %q, want %q", migrations[1].DownSQL, "DROP INDEX i;")
+	}
+	if migrations[1].Checksum != Checksum([]byte("CREATE INDEX i ON notes (id);")) {
+		t.Errorf("Checksum does not match the up script")
+	}
+}
+
+func TestLoadRejectsOrphanDownScript(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_orphan.down.sql": {Data: []byte("DROP INDEX i;")},
+	}
+
+	if _, err := Load(fsys); err == nil {
+		t.Error("Load() expected error for down script without up script")
+	}
+}
+
+func TestLoadRejectsDuplicateIDs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_x.sql":    {Data: []byte("SELECT 1;")},
+		"002_x.up.sql": {Data: []byte("SELECT 2;")},
+	}
+
+	if _, err := Load(fsys); err == nil {
+		t.Error("Load() expected error for duplicate migration ids")
+	}
+}
@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCompareSourcesIdentical(t *testing.T) {
+	fsys := fstest.MapFS{"001_x.sql": {Data: []byte("SELECT 1;\n")}}
+
+	err := CompareSources([]Source{{Name: "a", FS: fsys}, {Name: "b", FS: fsys}})
+	if err != nil {
+		t.Errorf("CompareSources() error = %v", err)
+	}
+}
+
+func TestCompareSourcesReportsDifferences(t *testing.T) {
+	ref := fstest.MapFS{
+		"001_x.sql": {Data: []byte("CREATE TABLE x ();\nSELECT 1;\n")},
+		"002_y.sql": {Data: []byte("SELECT 2;\n")},
+	}
+	drifted := fstest.MapFS{
+		"001_x.sql": {Data: []byte("CREATE TABLE x ();\nSELECT 42;\n")},
+		"003_z.sql": {Data: []byte("SELECT 3;\n")},
+	}
+
+	err := CompareSources([]Source{{Name: "root", FS: ref}, {Name: "app", FS: drifted}})
+
+	var copyErr *CopyMismatchError
+	if !errors.As(err, &copyErr) {
+		t.Fatalf("CompareSources() error = %v, want *CopyMismatchError", err)
+	}
+	if got := strings.Join(copyErr.Files, ","); got != "001_x.sql,002_y.sql,003_z.sql" {
+		t.Errorf("Files = %s", got)
+	}
+
+	for _, want := range []string{
+		"--- root/001_x.sql\n+++ app/001_x.sql\n",
+		"-SELECT 1;\n+SELECT 42;\n",
+		"Only in root: 002_y.sql (missing from app)\n",
+		"Only in app: 003_z.sql\n",
+	} {
+		if !strings.Contains(copyErr.Report, want) {
+			t.Errorf("Report missing %q:\n%s", want, copyErr.Report)
+		}
+	}
+}
+
+func TestDriftErrorReport(t *testing.T) {
+	err := &DriftError{Drifts: []Drift{
+		{Name: "001_x.sql", Recorded: "aaa", Current: "bbb"},
+		{Name: "002_y.sql", Recorded: "ccc"},
+	}}
+
+	want := `--- 001_x.sql (applied)
++++ 001_x.sql (on disk)
+-sha256 aaa
++sha256 bbb
+--- 002_y.sql (applied)
++++ /dev/null (file missing)
+-sha256 ccc
+`
+	if got := err.Report(); got != want {
+		t.Errorf("Report() =\n%s\nwant\n%s", got, want)
+	}
+	if !strings.Contains(err.Error(), "001_x.sql, 002_y.sql") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+}
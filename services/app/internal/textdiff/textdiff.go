@@ -0,0 +1,203 @@
+// Package textdiff produces line based unified diffs.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// maxTableCells bounds the LCS table diffLines builds, which takes memory
+// and time proportional to the product of the changed line counts.
+const maxTableCells = 1 << 20
+
+// op is one line of an edit script. a and b are the line indexes in the old
+// and new text at which the op applies.
+type op struct {
+	kind opKind
+	a, b int
+}
+
+// Unified returns a unified diff turning from into to with the given number
+// of context lines, or "" when the texts are equal.
+func Unified(fromName, toName, from, to string, context int) string {
+	a, b := splitLines(from), splitLines(to)
+	ops := diffLines(a, b)
+
+	var sb strings.Builder
+	for _, h := range hunks(ops, context) {
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		writeHunk(&sb, ops[h[0]:h[1]], a, b)
+	}
+	return sb.String()
+}
+
+// splitLines splits s after each newline. Lines keep their newline, so a
+// last line without one differs from the same line with one.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes a shortest edit script using the longest common
+// subsequence of the lines between the common prefix and suffix. When the
+// lines in between are too many for the LCS table it deletes and inserts
+// them wholesale: the diff is still correct, only no longer minimal.
+func diffLines(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	ops := make([]op, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{opEqual, i, i})
+	}
+	if (len(ma)+1)*(len(mb)+1) > maxTableCells {
+		for i := range ma {
+			ops = append(ops, op{opDelete, prefix + i, prefix})
+		}
+		for j := range mb {
+			ops = append(ops, op{opInsert, prefix + len(ma), prefix + j})
+		}
+	} else {
+		ops = appendLCSOps(ops, ma, mb, prefix)
+	}
+	for k := 0; k < suffix; k++ {
+		ops = append(ops, op{opEqual, len(a) - suffix + k, len(b) - suffix + k})
+	}
+
+	return ops
+}
+
+// appendLCSOps appends an edit script turning ma into mb, which start at
+// line offset in both texts, walking their longest common subsequence.
+func appendLCSOps(ops []op, ma, mb []string, offset int) []op {
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, op{opEqual, offset + i, offset + j})
+			i++
+			j++
+		case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, op{opDelete, offset + i, offset + j})
+			i++
+		default:
+			ops = append(ops, op{opInsert, offset + i, offset + j})
+			j++
+		}
+	}
+	return ops
+}
+
+// hunks groups changed ops into [start, end) ranges padded with context
+// lines. Changes separated by at most 2*context equal lines share a hunk.
+func hunks(ops []op, context int) [][2]int {
+	var result [][2]int
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		start, end := max(0, i-context), i
+		for end < len(ops) {
+			if ops[end].kind != opEqual {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == opEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = next
+		}
+
+		result = append(result, [2]int{start, end})
+		i = end
+	}
+	return result
+}
+
+func writeHunk(sb *strings.Builder, ops []op, a, b []string) {
+	aCount, bCount := 0, 0
+	for _, o := range ops {
+		if o.kind != opInsert {
+			aCount++
+		}
+		if o.kind != opDelete {
+			bCount++
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(ops[0].a, aCount), hunkRange(ops[0].b, bCount))
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			writeLine(sb, " ", a[o.a])
+		case opDelete:
+			writeLine(sb, "-", a[o.a])
+		case opInsert:
+			writeLine(sb, "+", b[o.b])
+		}
+	}
+}
+
+// writeLine writes one diff line, marking a last line that has no newline
+// as unified diff does.
+func writeLine(sb *strings.Builder, prefix, line string) {
+	sb.WriteString(prefix + line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,105 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedEqual(t *testing.T) {
+	if got := Unified("a", "b", "same\ntext\n", "same\ntext\n", 3); got != "" {
+		t.Errorf("Unified() = %q, want empty diff", got)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	from := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	to := "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+
+	want := `--- old
++++ new
+@@ -2,3 +2,3 @@
+ two
+-three
++THREE
+ four
+@@ -10 +10,2 @@
+ ten
++eleven
+`
+	if got := Unified("old", "new", from, to, 1); got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnifiedFromEmpty(t *testing.T) {
+	want := `--- old
++++ new
+@@ -0,0 +1,2 @@
++a
++b
+\ No newline at end of file
+`
+	if got := Unified("old", "new", "", "a\nb", 3); got != want {
+		t.Errorf("Unified() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnifiedTrailingNewline(t *testing.T) {
+	added := `--- old
++++ new
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`
+	if got := Unified("old", "new", "a\nb", "a\nb\n", 3); got != added {
+		t.Errorf("Unified(newline added) =\n%s\nwant\n%s", got, added)
+	}
+
+	removed := `--- old
++++ new
+@@ -1 +1 @@
+-a
++a
+\ No newline at end of file
+`
+	if got := Unified("old", "new", "a\n", "a", 3); got != removed {
+		t.Errorf("Unified(newline removed) =\n%s\nwant\n%s", got, removed)
+	}
+
+	if got := Unified("old", "new", "a\nb", "a\nb", 3); got != "" {
+		t.Errorf("Unified(equal, no newline) = %q, want empty diff", got)
+	}
+}
+
+func TestUnifiedTooLargeForTable(t *testing.T) {
+	var from, to strings.Builder
+	from.WriteString("head\n")
+	to.WriteString("head\n")
+	for i := 0; i < 1100; i++ {
+		fmt.Fprintf(&from, "a%d\nshared\n", i)
+		fmt.Fprintf(&to, "b%d\nshared\n", i)
+	}
+	from.WriteString("tail\n")
+	to.WriteString("tail\n")
+
+	got := Unified("old", "new", from.String(), to.String(), 1)
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if want := "@@ -1,2201 +1,2201 @@"; lines[2] != want {
+		t.Fatalf("hunk header = %q, want %q", lines[2], want)
+	}
+	deleted, inserted := 0, 0
+	for _, line := range lines[3:] {
+		switch line[0] {
+		case '-':
+			deleted++
+		case '+':
+			inserted++
+		}
+	}
+	if deleted != 2199 || inserted != 2199 {
+		t.Errorf("deleted %d and inserted %d lines, want the 2199 changed lines replaced wholesale", deleted, inserted)
+	}
+}
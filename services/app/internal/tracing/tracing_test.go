@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"infrastructure-training-back/internal/config"
+)
+
+const (
+	incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incomingSpanID  = "00f067aa0ba902b7"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	if _, err := Setup(context.Background(), config.TracingConfig{Exporter: "none"}); err != nil {
+		t.Fatal(err)
+	}
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestMiddlewareContinuesIncomingTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var handlerSpan trace.SpanContext
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/api/notes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	}).Methods("GET")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/notes/7", nil)
+	req.Header.Set("traceparent", "00-"+incomingTraceID+"-"+incomingSpanID+"-01")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name() != "GET /api/notes/{id}" {
+		t.Errorf("span name = %q", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != incomingTraceID {
+		t.Errorf("trace id = %s, want %s", got, incomingTraceID)
+	}
+	if got := span.Parent().SpanID().String(); got != incomingSpanID {
+		t.Errorf("parent span id = %s, want %s", got, incomingSpanID)
+	}
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Error("handler context does not carry the server span")
+	}
+	if span.Status().Code.String() != "Error" {
+		t.Errorf("status = %v, want Error for a 500", span.Status())
+	}
+
+	traceparent := rr.Header().Get("traceparent")
+	if !strings.Contains(traceparent, incomingTraceID) || !strings.Contains(traceparent, span.SpanContext().SpanID().String()) {
+		t.Errorf("response traceparent = %q, want the server span", traceparent)
+	}
+}
+
+func TestMiddlewareStartsNewTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	r := mux.NewRouter()
+	r.Use(Middleware)
+	r.HandleFunc("/health", func(http.ResponseWriter, *http.Request) {}).Methods("GET")
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Parent().IsValid() {
+		t.Fatalf("spans = %v, want one root span", spans)
+	}
+}
+
+func TestLogHandlerAddsTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil))).With("component", "test")
+
+	traceID, _ := trace.TraceIDFromHex(incomingTraceID)
+	spanID, _ := trace.SpanIDFromHex(incomingSpanID)
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+
+	logger.InfoContext(ctx, "with span")
+	logger.Info("without span")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var withSpan, withoutSpan map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &withSpan); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &withoutSpan); err != nil {
+		t.Fatal(err)
+	}
+
+	if withSpan["trace_id"] != incomingTraceID || withSpan["span_id"] != incomingSpanID || withSpan["component"] != "test" {
+		t.Errorf("record = %v", withSpan)
+	}
+	if _, ok := withoutSpan["trace_id"]; ok {
+		t.Errorf("record without span has trace_id: %v", withoutSpan)
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), config.TracingConfig{Exporter: "jaeger"}); err == nil {
+		t.Error("Setup() error = nil, want an error")
+	}
+}
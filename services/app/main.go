@@ -4,25 +4,57 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"flag"
 	"fmt"
-	"github.com/redis/go-redis/v9"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
+
+	"infrastructure-training-back/internal/auth"
+	"infrastructure-training-back/internal/config"
+	"infrastructure-training-back/internal/database"
+	"infrastructure-training-back/internal/tracing"
 )
 
 func main() {
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	loader := config.Register(flag.CommandLine)
+	createAPIKey := flag.String("create-api-key", "", "Create an API key with this name, print it and exit")
+	apiKeyScopes := flag.String("api-key-scopes", auth.ScopeAdmin, "Comma-separated scopes for -create-api-key")
+	flag.Parse()
+
+	cfg, err := loader.Load()
+	if loader.PrintRequested() && cfg != nil {
+		if err := cfg.Print(os.Stdout); err != nil {
+			os.Exit(1)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if loader.PrintRequested() {
+		return
+	}
+
+	logger := slog.New(tracing.NewLogHandler(requestIDLogHandler{slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: cfg.Log.SlogLevel(),
+	})}))
 	slog.SetDefault(logger)
 
-	db, err := initDB()
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+
+	queryTimeout = cfg.Database.QueryTimeout
+
+	db, err := database.Open(context.Background(), cfg.Database)
 	if err != nil {
 		slog.Error("Failed to initialize database", "error", err)
 		os.Exit(1)
@@ -34,7 +66,7 @@ func main() {
 		}
 	}(db)
 
-	rdb := initRedis()
+	rdb := initRedis(cfg.Redis)
 	if rdb != nil {
 		defer func(rdb *redis.Client) {
 			err := rdb.Close()
@@ -44,37 +76,118 @@ func main() {
 		}(rdb)
 	}
 
-	if err := runMigrations(db); err != nil {
+	migrator, err := runMigrations(db, cfg.Migrations)
+	if err != nil {
 		slog.Error("Failed to run migrations", "error", err)
 		os.Exit(1)
 	}
 
+	registry := newMetricsRegistry(db, notesCacheRequests, rateLimitedRequests)
+
+	store := newPostgresNoteStore(db)
+
+	keys := newPostgresAPIKeyStore(db)
+
+	if *createAPIKey != "" {
+		if err := printNewAPIKey(context.Background(), os.Stdout, keys, *createAPIKey, *apiKeyScopes); err != nil {
+			slog.Error("Failed to create API key", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Scopes are only enforced with authentication on; requireScope lets
+	// everything through for an empty scope.
+	var (
+		verifier              *auth.Verifier
+		readScope, writeScope string
+	)
+	if cfg.Auth.Enabled {
+		if cfg.Auth.TokensEnabled() {
+			verifier, err = auth.NewVerifier(cfg.Auth)
+			if err != nil {
+				slog.Error("Failed to initialize authentication", "error", err)
+				os.Exit(1)
+			}
+		}
+		readScope, writeScope = auth.ScopeNotesRead, auth.ScopeNotesWrite
+	}
+
+	cors := newCORSPolicy(cfg.CORS)
+
 	r := mux.NewRouter()
 
+	r.Use(tracing.Middleware)
+	r.Use(requestIDMiddleware)
 	r.Use(loggingMiddleware)
-	r.Use(corsMiddleware)
+	r.Use(corsMiddleware(cors))
+	// The per-IP limit runs before authentication so failed attempts are
+	// throttled; the per-client limit runs after it to tell principals apart.
+	var ipRateLimit, rateLimit mux.MiddlewareFunc
+	if cfg.RateLimit.Enabled {
+		limiter := newRateLimiter(rdb)
+		ipRateLimit, err = ipRateLimitMiddleware(limiter, cfg.RateLimit)
+		if err != nil {
+			slog.Error("Failed to initialize rate limiting", "error", err)
+			os.Exit(1)
+		}
+		rateLimit, err = rateLimitMiddleware(limiter, cfg.RateLimit)
+		if err != nil {
+			slog.Error("Failed to initialize rate limiting", "error", err)
+			os.Exit(1)
+		}
+		r.Use(ipRateLimit)
+	}
+	if cfg.Auth.Enabled {
+		r.Use(authMiddleware(verifier, keys, cfg.Auth.PublicPaths))
+	}
+	if rateLimit != nil {
+		r.Use(rateLimit)
+	}
 
 	r.HandleFunc("/health", healthHandler).Methods("GET")
+	r.HandleFunc("/livez", healthHandler).Methods("GET")
+	r.HandleFunc("/readyz", readyzHandler(cfg.Server.HealthCheckTimeout,
+		postgresCheck(db),
+		migrationsCheck(migrator),
+		redisCheck(rdb, cfg.Redis),
+	)).Methods("GET")
+	r.Handle("/metrics", metricsHandler(registry)).Methods("GET")
 	r.HandleFunc("/api/ping", pingHandler).Methods("GET")
-	r.HandleFunc("/api/notes", createNoteHandler(db, rdb)).Methods("POST")
-	r.HandleFunc("/api/notes", getNotesHandler(db, rdb)).Methods("GET")
-	r.HandleFunc("/api/notes/{id}", deleteNoteHandler(db, rdb)).Methods("DELETE")
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	r.HandleFunc("/api/notes", requireScope(writeScope, createNoteHandler(store, rdb))).Methods("POST")
+	r.HandleFunc("/api/notes", requireScope(readScope, getNotesHandler(store, rdb))).Methods("GET")
+	r.HandleFunc("/api/notes/search", requireScope(readScope, searchNotesHandler(store))).Methods("GET")
+	r.HandleFunc("/api/notes/trash", requireScope(readScope, getTrashHandler(store))).Methods("GET")
+	r.HandleFunc("/api/notes/trash/{id}", requireScope(writeScope, purgeNoteHandler(store, rdb))).Methods("DELETE")
+	r.HandleFunc("/api/notes/{id}", requireScope(readScope, getNoteHandler(store))).Methods("GET")
+	r.HandleFunc("/api/notes/{id}", requireScope(writeScope, updateNoteHandler(store, rdb))).Methods("PUT")
+	r.HandleFunc("/api/notes/{id}", requireScope(writeScope, patchNoteHandler(store, rdb))).Methods("PATCH")
+	r.HandleFunc("/api/notes/{id}", requireScope(writeScope, deleteNoteHandler(store, rdb))).Methods("DELETE")
+	r.HandleFunc("/api/notes/{id}/restore", requireScope(writeScope, restoreNoteHandler(store, rdb))).Methods("POST")
+	r.HandleFunc("/api/notes/{id}/revisions", requireScope(readScope, getNoteRevisionsHandler(store))).Methods("GET")
+	r.HandleFunc("/api/notes/{id}/revisions/{revision}", requireScope(readScope, getNoteRevisionHandler(store))).Methods("GET")
+	r.HandleFunc("/api/notes/{id}/revisions/{revision}/restore", requireScope(writeScope, restoreNoteRevisionHandler(store, rdb))).Methods("POST")
+	r.HandleFunc("/api/notes/{id}/diff", requireScope(readScope, diffNoteRevisionsHandler(store))).Methods("GET")
+	r.HandleFunc("/api/tags", requireScope(readScope, getTagsHandler(store))).Methods("GET")
+	if cfg.Auth.Enabled {
+		r.HandleFunc("/api/admin/api-keys", requireScope(auth.ScopeAdmin, createAPIKeyHandler(keys))).Methods("POST")
+		r.HandleFunc("/api/admin/api-keys", requireScope(auth.ScopeAdmin, listAPIKeysHandler(keys))).Methods("GET")
+		r.HandleFunc("/api/admin/api-keys/{id}", requireScope(auth.ScopeAdmin, revokeAPIKeyHandler(keys))).Methods("DELETE")
 	}
 
+	// Registered last: answers OPTIONS for every path above.
+	r.Methods("OPTIONS").HandlerFunc(preflightHandler(r, cors))
+
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%s", port),
-		Handler:      r,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:         cfg.Server.Addr(),
+		Handler:      metricsMiddleware(r),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
 	go func() {
-		slog.Info("Server starting", "port", port)
+		slog.Info("Server starting", "port", cfg.Server.Port)
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("Server failed to start", "error", err)
 			os.Exit(1)
@@ -87,7 +200,7 @@ func main() {
 
 	slog.Info("Server shutting down")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
@@ -95,5 +208,9 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+
 	slog.Info("Server stopped")
 }
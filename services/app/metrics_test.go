@@ -0,0 +1,112 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMetricsMiddlewareLabelsRouteTemplate(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/notes/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+	handler := metricsMiddleware(r)
+
+	matched := httpRequestsTotal.WithLabelValues("DELETE", "/api/notes/{id}", "204")
+	unmatched := httpRequestsTotal.WithLabelValues("GET", unmatchedRoute, "404")
+	other := httpRequestsTotal.WithLabelValues("OTHER", unmatchedRoute, "404")
+	beforeMatched, beforeUnmatched, beforeOther := testutil.ToFloat64(matched), testutil.ToFloat64(unmatched), testutil.ToFloat64(other)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodDelete, "/api/notes/41", nil),
+		httptest.NewRequest(http.MethodDelete, "/api/notes/42", nil),
+		httptest.NewRequest(http.MethodGet, "/no/such/path", nil),
+		httptest.NewRequest("BREW", "/coffee", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got := testutil.ToFloat64(matched) - beforeMatched; got != 2 {
+		t.Errorf("requests for /api/notes/{id} = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(unmatched) - beforeUnmatched; got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(other) - beforeOther; got != 1 {
+		t.Errorf("requests with an unknown method = %v, want 1", got)
+	}
+}
+
+func TestMetricsHandlerExposesAllFamilies(t *testing.T) {
+	// sql.Open does not connect, which is enough for the pool stats.
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	httpRequestsTotal.WithLabelValues("GET", "/health", "200").Inc()
+	httpRequestDuration.WithLabelValues("GET", "/health", "200").Observe(0.01)
+	observeMigration("001_create_notes_table.sql", "up", 20*time.Millisecond, nil)
+	recordNotesCacheLookup(nil)
+
+	rr := httptest.NewRecorder()
+	metricsHandler(newMetricsRegistry(db, notesCacheRequests)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rr.Body)
+
+	for _, family := range []string{
+		"http_requests_total",
+		"http_request_duration_seconds_bucket",
+		`go_sql_open_connections{db_name="postgres"}`,
+		`go_sql_max_open_connections{db_name="postgres"}`,
+		`migrations_total{direction="up",result="success"}`,
+		"migration_duration_seconds_bucket",
+		`notes_cache_requests_total{result="hit"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), family) {
+			t.Errorf("/metrics does not expose %s", family)
+		}
+	}
+}
+
+func TestRecordNotesCacheLookup(t *testing.T) {
+	for _, tt := range []struct {
+		err    error
+		result string
+	}{
+		{nil, "hit"},
+		{redis.Nil, "miss"},
+		{errors.New("i/o timeout"), "error"},
+	} {
+		counter := notesCacheRequests.WithLabelValues(tt.result)
+		before := testutil.ToFloat64(counter)
+
+		recordNotesCacheLookup(tt.err)
+
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("recordNotesCacheLookup(%v) incremented %s by %v, want 1", tt.err, tt.result, got)
+		}
+	}
+}
+
+func TestObserveMigrationCountsFailures(t *testing.T) {
+	counter := migrationsTotal.WithLabelValues("down", "error")
+	before := testutil.ToFloat64(counter)
+
+	observeMigration("002_add_notes_search", "down", time.Second, errors.New("boom"))
+
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("failed down migrations = %v, want 1", got)
+	}
+}
@@ -0,0 +1,4 @@
+-- Drop notes table together with its trigger and index
+DROP TABLE IF EXISTS notes;
+
+DROP FUNCTION IF EXISTS update_updated_at_column();
@@ -0,0 +1,7 @@
+-- Add full-text search vector over note text
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS search_vector tsvector
+        GENERATED ALWAYS AS (to_tsvector('simple', text)) STORED;
+
+-- Create GIN index for full-text search queries
+CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector);
@@ -0,0 +1,5 @@
+-- Drop note owners
+DROP INDEX IF EXISTS idx_notes_user_id_created_at;
+CREATE INDEX IF NOT EXISTS idx_notes_created_at ON notes (created_at DESC);
+
+ALTER TABLE notes DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,44 @@
+-- Keep every version of a note's text. Revision 1 is the text a note was
+-- created with; each update that changes the text adds the next revision.
+CREATE TABLE IF NOT EXISTS note_revisions
+(
+    note_id    INTEGER NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    revision   INTEGER NOT NULL,
+    text       TEXT    NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (note_id, revision)
+);
+
+-- Existing notes start their history with their current text
+INSERT INTO note_revisions (note_id, revision, text, created_at)
+SELECT id, 1, text, updated_at
+FROM notes
+ON CONFLICT DO NOTHING;
+
+-- Create function to append the new text of a note as its next revision.
+-- Concurrent updates of one note are serialized by the row lock on notes.
+CREATE OR REPLACE FUNCTION record_note_revision()
+    RETURNS TRIGGER AS
+$$
+BEGIN
+    INSERT INTO note_revisions (note_id, revision, text, created_at)
+    SELECT NEW.id, COALESCE(MAX(revision), 0) + 1, NEW.text, NEW.updated_at
+    FROM note_revisions
+    WHERE note_id = NEW.id;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE OR REPLACE TRIGGER record_notes_revision_on_insert
+    AFTER INSERT
+    ON notes
+    FOR EACH ROW
+EXECUTE FUNCTION record_note_revision();
+
+-- Moving a note to the trash and back leaves its text, and history, alone
+CREATE OR REPLACE TRIGGER record_notes_revision_on_update
+    AFTER UPDATE OF text
+    ON notes
+    FOR EACH ROW
+    WHEN (OLD.text IS DISTINCT FROM NEW.text)
+EXECUTE FUNCTION record_note_revision();
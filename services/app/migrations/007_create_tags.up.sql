@@ -0,0 +1,19 @@
+-- Tags belong to a user like the notes they label and are attached to notes
+-- through note_tags. Names are stored normalized to lower case.
+CREATE TABLE IF NOT EXISTS tags
+(
+    id      SERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name    TEXT NOT NULL,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS note_tags
+(
+    note_id INTEGER NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    tag_id  INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (note_id, tag_id)
+);
+
+-- The primary key serves lookups by note; this one serves filters by tag
+CREATE INDEX IF NOT EXISTS idx_note_tags_tag_id ON note_tags (tag_id);
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"testing"
+
+	"infrastructure-training-back/internal/migrate"
+)
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	loaded, err := migrate.Load(FS(""))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	if loaded[0].Name != "001_create_notes_table.sql" {
+		t.Errorf("first migration = %s, want 001_create_notes_table.sql", loaded[0].Name)
+	}
+	// Applied migrations are recorded by name, so shipped files keep theirs.
+	if len(loaded) < 2 {
+		t.Fatalf("loaded %d migrations", len(loaded))
+	}
+	if loaded[1].Name != "002_add_notes_search.sql" || !loaded[1].Reversible() {
+		t.Errorf("second migration = %s (reversible %t), want reversible 002_add_notes_search.sql", loaded[1].Name, loaded[1].Reversible())
+	}
+}
+
+func TestDirOverridesEmbeddedMigrations(t *testing.T) {
+	loaded, err := migrate.Load(FS(t.TempDir()))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded) != 0 {
+		t.Errorf("Load() returned %d migrations from an empty directory", len(loaded))
+	}
+}
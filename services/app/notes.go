@@ -2,147 +2,198 @@ package main
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
+
+	"infrastructure-training-back/internal/auth"
+)
+
+const (
+	// maxNoteTextLength bounds note text in characters, and with it the work
+	// of diffing two revisions.
+	maxNoteTextLength = 100000
+	// maxRequestBodyBytes bounds JSON request bodies. It fits the longest
+	// note text with tags and JSON escaping.
+	maxRequestBodyBytes = 1 << 20
 )
 
+var noteTextTooLong = "Text must be at most " + strconv.Itoa(maxNoteTextLength) + " characters"
+
 type Note struct {
 	ID        int       `json:"id" db:"id"`
 	Text      string    `json:"text" db:"text"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// DeletedAt is set while the note is in the trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Tags are normalized and sorted by name.
+	Tags []string `json:"tags" db:"tags"`
+}
+
+// NotesPage is the response envelope for GET /api/notes. NextCursor is nil on
+// the last page.
+type NotesPage struct {
+	Notes      []Note  `json:"notes"`
+	NextCursor *string `json:"next_cursor"`
 }
 
 type NoteCreateRequest struct {
-	Text string `json:"text"`
+	Text string   `json:"text"`
+	Tags []string `json:"tags"`
+}
+
+// NoteUpdateRequest replaces the whole note, so leaving out tags removes
+// them.
+type NoteUpdateRequest struct {
+	Text string   `json:"text"`
+	Tags []string `json:"tags"`
 }
 
-func getNotesHandler(db *sql.DB, rdb *redis.Client) http.HandlerFunc {
+type NotePatchRequest struct {
+	Text *string   `json:"text"`
+	Tags *[]string `json:"tags"`
+}
+
+// noteOwner returns the user whose notes a request works with: the
+// authenticated principal, or the anonymous user "" when authentication is
+// disabled.
+func noteOwner(ctx context.Context) string {
+	principal, _ := auth.FromContext(ctx)
+	return principal.Subject
+}
+
+func getNotesHandler(store NoteStore, rdb *redis.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		ctx := context.Background()
+		ctx := r.Context()
 
-		// Try to get from cache first
-		if rdb != nil {
-			cachedNotes, err := rdb.Get(ctx, "notes:all").Result()
-			if err == nil {
-				w.Header().Set("X-Cache", "HIT")
-				w.WriteHeader(http.StatusOK)
-				_, err := w.Write([]byte(cachedNotes))
-				if err != nil {
-					return
-				}
+		limit, cursor, err := parsePageParams(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid pagination parameters"))
+			if err != nil {
 				return
 			}
+			return
 		}
 
-		rows, err := db.Query("SELECT id, text, created_at, updated_at FROM notes ORDER BY created_at DESC")
+		filter, err := parseNoteFilter(r.URL.Query())
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database error"})
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid tag filter"))
 			if err != nil {
 				return
 			}
 			return
 		}
-		defer func(rows *sql.Rows) {
-			err := rows.Close()
-			if err != nil {
-
-			}
-		}(rows)
 
-		var notes []Note
-		for rows.Next() {
-			var note Note
-			err := rows.Scan(&note.ID, &note.Text, &note.CreatedAt, &note.UpdatedAt)
+		// Try to get from cache first
+		var cacheKey string
+		if rdb != nil {
+			cacheKey, err = notesPageCacheKey(ctx, rdb, noteOwner(ctx), limit, r.URL.Query().Get("cursor"), filter)
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database scan error"})
+				slog.WarnContext(ctx, "Failed to build notes cache key", "error", err)
+			}
+		}
+		if cacheKey != "" {
+			cachedPage, err := rdb.Get(ctx, cacheKey).Result()
+			recordNotesCacheLookup(err)
+			if err == nil {
+				w.Header().Set("X-Cache", "HIT")
+				w.WriteHeader(http.StatusOK)
+				_, err := w.Write([]byte(cachedPage))
 				if err != nil {
 					return
 				}
 				return
 			}
-			notes = append(notes, note)
 		}
 
-		if notes == nil {
-			notes = []Note{}
+		queryCtx, cancel := withQueryTimeout(ctx)
+		defer cancel()
+
+		page, err := store.List(queryCtx, noteOwner(ctx), filter, limit, cursor)
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
 		}
 
-		// Cache the result for 5 minutes
-		if rdb != nil {
-			notesJSON, _ := json.Marshal(notes)
-			err = rdb.Set(ctx, "notes:all", notesJSON, 5*time.Minute).Err()
+		// Cache the page for 5 minutes
+		if cacheKey != "" {
+			pageJSON, _ := json.Marshal(page)
+			err = rdb.Set(ctx, cacheKey, pageJSON, 5*time.Minute).Err()
 			if err != nil {
-				slog.Warn("Failed to cache notes", "error", err)
+				slog.WarnContext(ctx, "Failed to cache notes", "error", err)
 			}
 		}
 
 		w.Header().Set("X-Cache", "MISS")
 		w.WriteHeader(http.StatusOK)
-		err = json.NewEncoder(w).Encode(notes)
+		err = json.NewEncoder(w).Encode(page)
 		if err != nil {
 			return
 		}
 	}
 }
 
-func createNoteHandler(db *sql.DB, rdb *redis.Client) http.HandlerFunc {
+func createNoteHandler(store NoteStore, rdb *redis.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
 		var req NoteCreateRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if !decodeRequestBody(w, r, &req) {
+			return
+		}
+
+		if req.Text == "" {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid JSON"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Text field is required"))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		if req.Text == "" {
+		if utf8.RuneCountInString(req.Text) > maxNoteTextLength {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Text field is required"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), noteTextTooLong))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		var note Note
-		err := db.QueryRow(`
-			INSERT INTO notes (text) 
-			VALUES ($1) 
-			RETURNING id, text, created_at, updated_at`,
-			req.Text).Scan(&note.ID, &note.Text, &note.CreatedAt, &note.UpdatedAt)
-
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database error"})
+		tags, problem := normalizeTags(req.Tags)
+		if problem != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), problem))
 			if err != nil {
 				return
 			}
 			return
 		}
 
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		note, err := store.Create(queryCtx, noteOwner(r.Context()), req.Text, tags)
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
 		// Invalidate cache after creating a note
 		if rdb != nil {
-			ctx := context.Background()
-			err = rdb.Del(ctx, "notes:all").Err()
-			if err != nil {
-				slog.Warn("Failed to invalidate cache", "error", err)
-			}
+			invalidateNotesCache(context.WithoutCancel(r.Context()), rdb, noteOwner(r.Context()))
 		}
 
 		w.WriteHeader(http.StatusCreated)
@@ -153,7 +204,7 @@ func createNoteHandler(db *sql.DB, rdb *redis.Client) http.HandlerFunc {
 	}
 }
 
-func deleteNoteHandler(db *sql.DB, rdb *redis.Client) http.HandlerFunc {
+func deleteNoteHandler(store NoteStore, rdb *redis.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
@@ -161,7 +212,7 @@ func deleteNoteHandler(db *sql.DB, rdb *redis.Client) http.HandlerFunc {
 		idStr, exists := vars["id"]
 		if !exists {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "ID is required"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "ID is required"))
 			if err != nil {
 				return
 			}
@@ -171,55 +222,369 @@ func deleteNoteHandler(db *sql.DB, rdb *redis.Client) http.HandlerFunc {
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Invalid ID format"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		result, err := db.Exec("DELETE FROM notes WHERE id = $1", id)
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		err = store.Delete(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found"))
+			if err != nil {
+				return
+			}
+			return
+		}
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database error"})
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		// Invalidate cache after moving a note to the trash
+		if rdb != nil {
+			invalidateNotesCache(context.WithoutCancel(r.Context()), rdb, noteOwner(r.Context()))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(map[string]string{"message": "Note moved to trash"})
+		if err != nil {
+			return
+		}
+	}
+}
+
+// getTrashHandler lists trashed notes, paginated like GET /api/notes. The
+// trash is not cached.
+func getTrashHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		limit, cursor, err := parsePageParams(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid pagination parameters"))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		rowsAffected, err := result.RowsAffected()
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		page, err := store.Trash(queryCtx, noteOwner(r.Context()), limit, cursor)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Database error"})
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func restoreNoteHandler(store NoteStore, rdb *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
 			if err != nil {
 				return
 			}
 			return
 		}
 
-		if rowsAffected == 0 {
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		note, err := store.Restore(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
 			w.WriteHeader(http.StatusNotFound)
-			err := json.NewEncoder(w).Encode(ErrorResponse{Error: "Note not found"})
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found in trash"))
 			if err != nil {
 				return
 			}
 			return
 		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		// Invalidate cache after restoring a note
+		if rdb != nil {
+			invalidateNotesCache(context.WithoutCancel(r.Context()), rdb, noteOwner(r.Context()))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(note)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// purgeNoteHandler removes a trashed note permanently.
+func purgeNoteHandler(store NoteStore, rdb *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		err = store.Purge(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found in trash"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
 
-		// Invalidate cache after deleting a note
+		// Invalidate cache after purging a note
 		if rdb != nil {
-			ctx := context.Background()
-			err = rdb.Del(ctx, "notes:all").Err()
+			invalidateNotesCache(context.WithoutCancel(r.Context()), rdb, noteOwner(r.Context()))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(map[string]string{"message": "Note purged"})
+		if err != nil {
+			return
+		}
+	}
+}
+
+func getNoteHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
 			if err != nil {
-				slog.Warn("Failed to invalidate cache", "error", err)
+				return
 			}
+			return
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		note, err := store.Get(queryCtx, noteOwner(r.Context()), id)
+		if errors.Is(err, errNoteNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Note not found"))
+			if err != nil {
+				return
+			}
+			return
+		}
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
 		}
 
 		w.WriteHeader(http.StatusOK)
-		err = json.NewEncoder(w).Encode(map[string]string{"message": "Note deleted successfully"})
+		err = json.NewEncoder(w).Encode(note)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func updateNoteHandler(store NoteStore, rdb *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
 		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
 			return
 		}
+
+		var req NoteUpdateRequest
+		if !decodeRequestBody(w, r, &req) {
+			return
+		}
+
+		if req.Text == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Text field is required"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		if utf8.RuneCountInString(req.Text) > maxNoteTextLength {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), noteTextTooLong))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		tags, problem := normalizeTags(req.Tags)
+		if problem != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), problem))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		writeUpdatedNote(r.Context(), w, store, rdb, id, noteChanges{Text: &req.Text, Tags: &tags})
+	}
+}
+
+func patchNoteHandler(store NoteStore, rdb *redis.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid ID format"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		var req NotePatchRequest
+		if !decodeRequestBody(w, r, &req) {
+			return
+		}
+
+		if req.Text == nil && req.Tags == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "No fields to update"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		if req.Text != nil && *req.Text == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Text field cannot be empty"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		if req.Text != nil && utf8.RuneCountInString(*req.Text) > maxNoteTextLength {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), noteTextTooLong))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		changes := noteChanges{Text: req.Text}
+		if req.Tags != nil {
+			tags, problem := normalizeTags(*req.Tags)
+			if problem != "" {
+				w.WriteHeader(http.StatusBadRequest)
+				err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), problem))
+				if err != nil {
+					return
+				}
+				return
+			}
+			changes.Tags = &tags
+		}
+
+		writeUpdatedNote(r.Context(), w, store, rdb, id, changes)
+	}
+}
+
+// decodeRequestBody reads a JSON request body into v, capped at
+// maxRequestBodyBytes. It responds 400 or 413 and returns false when the
+// body cannot be used.
+func decodeRequestBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+
+	status, message := http.StatusBadRequest, "Invalid JSON"
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		status, message = http.StatusRequestEntityTooLarge, "Request body too large"
+	}
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(newErrorResponse(r.Context(), message))
+	if err != nil {
+		return false
+	}
+	return false
+}
+
+// writeUpdatedNote applies changes and responds with the updated note.
+func writeUpdatedNote(ctx context.Context, w http.ResponseWriter, store NoteStore, rdb *redis.Client, id int, changes noteChanges) {
+	queryCtx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	note, err := store.Update(queryCtx, noteOwner(ctx), id, changes)
+	if errors.Is(err, errNoteNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		err := json.NewEncoder(w).Encode(newErrorResponse(ctx, "Note not found"))
+		if err != nil {
+			return
+		}
+		return
+	}
+	if err != nil {
+		writeDatabaseError(queryCtx, w, err)
+		return
+	}
+
+	// Invalidate cache after updating a note
+	if rdb != nil {
+		invalidateNotesCache(context.WithoutCancel(ctx), rdb, noteOwner(ctx))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(w).Encode(note)
+	if err != nil {
+		return
 	}
 }
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/auth"
+)
+
+func TestNoteHandlersRejectInvalidInput(t *testing.T) {
+	longText := `"` + strings.Repeat("ж", maxNoteTextLength+1) + `"`
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/notes/{id}", getNoteHandler(nil)).Methods("GET")
+	r.HandleFunc("/api/notes/{id}", updateNoteHandler(nil, nil)).Methods("PUT")
+	r.HandleFunc("/api/notes/{id}", patchNoteHandler(nil, nil)).Methods("PATCH")
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected string
+	}{
+		{"get invalid id", "GET", "/api/notes/abc", "", `{"error":"Invalid ID format"}`},
+		{"put invalid id", "PUT", "/api/notes/abc", `{"text":"x"}`, `{"error":"Invalid ID format"}`},
+		{"put invalid json", "PUT", "/api/notes/1", `{`, `{"error":"Invalid JSON"}`},
+		{"put empty text", "PUT", "/api/notes/1", `{"text":""}`, `{"error":"Text field is required"}`},
+		{"patch no fields", "PATCH", "/api/notes/1", `{}`, `{"error":"No fields to update"}`},
+		{"patch empty text", "PATCH", "/api/notes/1", `{"text":""}`, `{"error":"Text field cannot be empty"}`},
+		{"put long text", "PUT", "/api/notes/1", `{"text":` + longText + `}`, `{"error":"Text must be at most 100000 characters"}`},
+		{"patch long text", "PATCH", "/api/notes/1", `{"text":` + longText + `}`, `{"error":"Text must be at most 100000 characters"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+			}
+			if rr.Body.String() != tt.expected+"\n" {
+				t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestNoteBodyTooLarge(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+	body := `{"text":"` + strings.Repeat("x", maxRequestBodyBytes) + `"}`
+
+	for _, method := range []string{"POST", "PUT", "PATCH"} {
+		path := "/api/notes"
+		if method != "POST" {
+			path = "/api/notes/1"
+		}
+		rr := serve(t, r, method, path, body, http.StatusRequestEntityTooLarge)
+		if resp := decode[ErrorResponse](t, rr); resp.Error != "Request body too large" {
+			t.Errorf("%s: error = %q", method, resp.Error)
+		}
+	}
+
+	rr := serve(t, r, "POST", "/api/notes", `{"text":"`+strings.Repeat("ж", maxNoteTextLength)+`"}`, http.StatusCreated)
+	if note := decode[Note](t, rr); len(note.Text) != 2*maxNoteTextLength {
+		t.Errorf("created text has %d bytes, want %d", len(note.Text), 2*maxNoteTextLength)
+	}
+}
+
+// newNotesRouter registers the note routes as main does, without Redis.
+func newNotesRouter(store NoteStore) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/notes", createNoteHandler(store, nil)).Methods("POST")
+	r.HandleFunc("/api/notes", getNotesHandler(store, nil)).Methods("GET")
+	r.HandleFunc("/api/notes/search", searchNotesHandler(store)).Methods("GET")
+	r.HandleFunc("/api/notes/trash", getTrashHandler(store)).Methods("GET")
+	r.HandleFunc("/api/notes/trash/{id}", purgeNoteHandler(store, nil)).Methods("DELETE")
+	r.HandleFunc("/api/notes/{id}", getNoteHandler(store)).Methods("GET")
+	r.HandleFunc("/api/notes/{id}", updateNoteHandler(store, nil)).Methods("PUT")
+	r.HandleFunc("/api/notes/{id}", patchNoteHandler(store, nil)).Methods("PATCH")
+	r.HandleFunc("/api/notes/{id}", deleteNoteHandler(store, nil)).Methods("DELETE")
+	r.HandleFunc("/api/notes/{id}/restore", restoreNoteHandler(store, nil)).Methods("POST")
+	r.HandleFunc("/api/notes/{id}/revisions", getNoteRevisionsHandler(store)).Methods("GET")
+	r.HandleFunc("/api/notes/{id}/revisions/{revision}", getNoteRevisionHandler(store)).Methods("GET")
+	r.HandleFunc("/api/notes/{id}/revisions/{revision}/restore", restoreNoteRevisionHandler(store, nil)).Methods("POST")
+	r.HandleFunc("/api/notes/{id}/diff", diffNoteRevisionsHandler(store)).Methods("GET")
+	r.HandleFunc("/api/tags", getTagsHandler(store)).Methods("GET")
+	return r
+}
+
+func serve(t *testing.T, r http.Handler, method, path, body string, wantCode int) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if rr.Code != wantCode {
+		t.Fatalf("%s %s: code = %d, want %d, body %s", method, path, rr.Code, wantCode, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: Content-Type = %q", method, path, ct)
+	}
+	return rr
+}
+
+func decode[T any](t *testing.T, rr *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.NewDecoder(rr.Body).Decode(&v); err != nil {
+		t.Fatalf("failed to decode %s: %v", rr.Body.String(), err)
+	}
+	return v
+}
+
+func TestCreateNoteHandler(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+
+	note := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"buy milk"}`, http.StatusCreated))
+	if note.ID != 1 || note.Text != "buy milk" || note.CreatedAt.IsZero() || !note.UpdatedAt.Equal(note.CreatedAt) {
+		t.Errorf("created note = %+v", note)
+	}
+
+	for _, body := range []string{`{`, `{"text":""}`, `{}`} {
+		errBody := decode[ErrorResponse](t, serve(t, r, "POST", "/api/notes", body, http.StatusBadRequest))
+		if errBody.Error == "" {
+			t.Errorf("POST %s: empty error", body)
+		}
+	}
+}
+
+func TestGetNotesHandlerPaginates(t *testing.T) {
+	store := newMemoryNoteStore()
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	r := newNotesRouter(store)
+
+	empty := serve(t, r, "GET", "/api/notes", "", http.StatusOK)
+	if got := strings.TrimSpace(empty.Body.String()); got != `{"notes":[],"next_cursor":null}` {
+		t.Errorf("empty list = %s", got)
+	}
+
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		serve(t, r, "POST", "/api/notes", `{"text":"`+text+`"}`, http.StatusCreated)
+	}
+
+	var texts []string
+	path := "/api/notes?limit=2"
+	for {
+		rr := serve(t, r, "GET", path, "", http.StatusOK)
+		if rr.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("X-Cache = %q without Redis", rr.Header().Get("X-Cache"))
+		}
+		page := decode[NotesPage](t, rr)
+		if len(page.Notes) > 2 {
+			t.Fatalf("page has %d notes, limit is 2", len(page.Notes))
+		}
+		for _, note := range page.Notes {
+			texts = append(texts, note.Text)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		path = "/api/notes?limit=2&cursor=" + *page.NextCursor
+	}
+
+	if got := strings.Join(texts, ""); got != "edcba" {
+		t.Errorf("listed %q, want newest first edcba", got)
+	}
+
+	serve(t, r, "GET", "/api/notes?cursor=garbage!", "", http.StatusBadRequest)
+	serve(t, r, "GET", "/api/notes?limit=0", "", http.StatusBadRequest)
+}
+
+func TestNoteLifecycle(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+
+	created := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"draft"}`, http.StatusCreated))
+
+	got := decode[Note](t, serve(t, r, "GET", "/api/notes/1", "", http.StatusOK))
+	if !reflect.DeepEqual(got, created) {
+		t.Errorf("GET = %+v, want %+v", got, created)
+	}
+
+	put := decode[Note](t, serve(t, r, "PUT", "/api/notes/1", `{"text":"final"}`, http.StatusOK))
+	if put.Text != "final" || put.ID != created.ID {
+		t.Errorf("PUT = %+v", put)
+	}
+
+	patched := decode[Note](t, serve(t, r, "PATCH", "/api/notes/1", `{"text":"final, patched"}`, http.StatusOK))
+	if patched.Text != "final, patched" {
+		t.Errorf("PATCH = %+v", patched)
+	}
+
+	deleted := decode[map[string]string](t, serve(t, r, "DELETE", "/api/notes/1", "", http.StatusOK))
+	if deleted["message"] != "Note moved to trash" {
+		t.Errorf("DELETE = %v", deleted)
+	}
+
+	for _, req := range []struct{ method, body string }{
+		{"GET", ""},
+		{"PUT", `{"text":"x"}`},
+		{"PATCH", `{"text":"x"}`},
+		{"DELETE", ""},
+	} {
+		errBody := decode[ErrorResponse](t, serve(t, r, req.method, "/api/notes/1", req.body, http.StatusNotFound))
+		if errBody.Error != "Note not found" {
+			t.Errorf("%s deleted note: error = %q", req.method, errBody.Error)
+		}
+	}
+
+	serve(t, r, "DELETE", "/api/notes/abc", "", http.StatusBadRequest)
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+
+	keep := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"keep"}`, http.StatusCreated))
+	restored := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"restore me"}`, http.StatusCreated))
+	purged := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"purge me"}`, http.StatusCreated))
+
+	// Only trashed notes can be restored or purged.
+	serve(t, r, "POST", "/api/notes/"+strconv.Itoa(keep.ID)+"/restore", "", http.StatusNotFound)
+	serve(t, r, "DELETE", "/api/notes/trash/"+strconv.Itoa(keep.ID), "", http.StatusNotFound)
+
+	serve(t, r, "DELETE", "/api/notes/"+strconv.Itoa(restored.ID), "", http.StatusOK)
+	serve(t, r, "DELETE", "/api/notes/"+strconv.Itoa(purged.ID), "", http.StatusOK)
+
+	page := decode[NotesPage](t, serve(t, r, "GET", "/api/notes", "", http.StatusOK))
+	if len(page.Notes) != 1 || page.Notes[0].ID != keep.ID || page.Notes[0].DeletedAt != nil {
+		t.Errorf("GET /api/notes = %+v, want only %q", page.Notes, keep.Text)
+	}
+	trash := decode[NotesPage](t, serve(t, r, "GET", "/api/notes/trash?limit=1", "", http.StatusOK))
+	if len(trash.Notes) != 1 || trash.Notes[0].ID != purged.ID || trash.Notes[0].DeletedAt == nil || trash.NextCursor == nil {
+		t.Fatalf("GET /api/notes/trash = %+v", trash)
+	}
+	trash = decode[NotesPage](t, serve(t, r, "GET", "/api/notes/trash?cursor="+*trash.NextCursor, "", http.StatusOK))
+	if len(trash.Notes) != 1 || trash.Notes[0].ID != restored.ID {
+		t.Errorf("second trash page = %+v", trash)
+	}
+
+	got := decode[Note](t, serve(t, r, "POST", "/api/notes/"+strconv.Itoa(restored.ID)+"/restore", "", http.StatusOK))
+	if got.Text != "restore me" || got.DeletedAt != nil {
+		t.Errorf("restore = %+v", got)
+	}
+	serve(t, r, "GET", "/api/notes/"+strconv.Itoa(restored.ID), "", http.StatusOK)
+
+	msg := decode[map[string]string](t, serve(t, r, "DELETE", "/api/notes/trash/"+strconv.Itoa(purged.ID), "", http.StatusOK))
+	if msg["message"] != "Note purged" {
+		t.Errorf("purge = %v", msg)
+	}
+	serve(t, r, "POST", "/api/notes/"+strconv.Itoa(purged.ID)+"/restore", "", http.StatusNotFound)
+	if trash := decode[NotesPage](t, serve(t, r, "GET", "/api/notes/trash", "", http.StatusOK)); len(trash.Notes) != 0 {
+		t.Errorf("trash after restore and purge = %+v", trash.Notes)
+	}
+
+	serve(t, r, "POST", "/api/notes/abc/restore", "", http.StatusBadRequest)
+	serve(t, r, "DELETE", "/api/notes/trash/abc", "", http.StatusBadRequest)
+}
+
+// failingNoteStore fails every call, standing in for a broken database.
+type failingNoteStore struct{}
+
+var errStoreDown = errors.New("connection refused")
+
+func (failingNoteStore) Create(context.Context, string, string, []string) (Note, error) {
+	return Note{}, errStoreDown
+}
+func (failingNoteStore) Get(context.Context, string, int) (Note, error) { return Note{}, errStoreDown }
+func (failingNoteStore) List(context.Context, string, noteFilter, int, *noteCursor) (NotesPage, error) {
+	return NotesPage{}, errStoreDown
+}
+func (failingNoteStore) Update(context.Context, string, int, noteChanges) (Note, error) {
+	return Note{}, errStoreDown
+}
+func (failingNoteStore) Delete(context.Context, string, int) error { return errStoreDown }
+func (failingNoteStore) Search(context.Context, string, searchQuery, int) ([]NoteSearchResult, error) {
+	return nil, errStoreDown
+}
+func (failingNoteStore) Trash(context.Context, string, int, *noteCursor) (NotesPage, error) {
+	return NotesPage{}, errStoreDown
+}
+func (failingNoteStore) Restore(context.Context, string, int) (Note, error) {
+	return Note{}, errStoreDown
+}
+func (failingNoteStore) Purge(context.Context, string, int) error { return errStoreDown }
+func (failingNoteStore) Revisions(context.Context, string, int) ([]NoteRevision, error) {
+	return nil, errStoreDown
+}
+func (failingNoteStore) Revision(context.Context, string, int, int) (NoteRevision, error) {
+	return NoteRevision{}, errStoreDown
+}
+func (failingNoteStore) Tags(context.Context, string) ([]TagCount, error) { return nil, errStoreDown }
+
+func TestNoteHandlersReportStoreErrors(t *testing.T) {
+	r := newNotesRouter(failingNoteStore{})
+
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", "/api/notes", `{"text":"x"}`},
+		{"GET", "/api/notes", ""},
+		{"GET", "/api/notes/search?q=x", ""},
+		{"GET", "/api/notes/1", ""},
+		{"PUT", "/api/notes/1", `{"text":"x"}`},
+		{"PATCH", "/api/notes/1", `{"text":"x"}`},
+		{"DELETE", "/api/notes/1", ""},
+		{"GET", "/api/notes/trash", ""},
+		{"POST", "/api/notes/1/restore", ""},
+		{"DELETE", "/api/notes/trash/1", ""},
+		{"GET", "/api/notes/1/revisions", ""},
+		{"GET", "/api/notes/1/revisions/1", ""},
+		{"POST", "/api/notes/1/revisions/1/restore", ""},
+		{"GET", "/api/notes/1/diff?from=1&to=2", ""},
+		{"GET", "/api/tags", ""},
+	} {
+		errBody := decode[ErrorResponse](t, serve(t, r, req.method, req.path, req.body, http.StatusInternalServerError))
+		if errBody.Error != "Database error" {
+			t.Errorf("%s %s: error = %q", req.method, req.path, errBody.Error)
+		}
+	}
+}
+
+// asUser authenticates every request to h as subject.
+func asUser(subject string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Subject: subject})))
+	})
+}
+
+func TestNotesAreScopedToTheCaller(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+	alice, bob := asUser("alice", r), asUser("bob", r)
+
+	note := decode[Note](t, serve(t, alice, "POST", "/api/notes", `{"text":"alice's note"}`, http.StatusCreated))
+	path := "/api/notes/" + strconv.Itoa(note.ID)
+
+	// Other users get 404, not 403, so ids of foreign notes are not revealed.
+	serve(t, bob, "GET", path, "", http.StatusNotFound)
+	serve(t, bob, "PUT", path, `{"text":"bob was here"}`, http.StatusNotFound)
+	serve(t, bob, "PATCH", path, `{"text":"bob was here"}`, http.StatusNotFound)
+	serve(t, bob, "DELETE", path, "", http.StatusNotFound)
+	if page := decode[NotesPage](t, serve(t, bob, "GET", "/api/notes", "", http.StatusOK)); len(page.Notes) != 0 {
+		t.Errorf("bob lists %+v", page.Notes)
+	}
+	// Without authentication requests act as the anonymous user.
+	serve(t, r, "GET", path, "", http.StatusNotFound)
+
+	if got := decode[Note](t, serve(t, alice, "GET", path, "", http.StatusOK)); got.Text != "alice's note" {
+		t.Errorf("alice gets %+v", got)
+	}
+	serve(t, alice, "DELETE", path, "", http.StatusOK)
+}
+
+func TestSearchNotes(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+	alice := asUser("alice", r)
+
+	pool := decode[Note](t, serve(t, alice, "POST", "/api/notes", `{"text":"Tune the connection pool"}`, http.StatusCreated))
+	both := decode[Note](t, serve(t, alice, "POST", "/api/notes", `{"text":"Pool size: connection pool limits"}`, http.StatusCreated))
+	serve(t, alice, "POST", "/api/notes", `{"text":"Connection timeouts"}`, http.StatusCreated)
+	trashed := decode[Note](t, serve(t, alice, "POST", "/api/notes", `{"text":"old connection pool notes"}`, http.StatusCreated))
+	serve(t, alice, "DELETE", "/api/notes/"+strconv.Itoa(trashed.ID), "", http.StatusOK)
+	serve(t, asUser("bob", r), "POST", "/api/notes", `{"text":"bob's connection pool"}`, http.StatusCreated)
+
+	got := decode[NoteSearchResponse](t, serve(t, alice, "GET", "/api/notes/search?q=pool+conn*", "", http.StatusOK))
+	if len(got.Results) != 2 || got.Results[0].ID != both.ID || got.Results[1].ID != pool.ID {
+		t.Fatalf("search = %+v, want notes %d then %d", got.Results, both.ID, pool.ID)
+	}
+	if want := "Tune the <mark>connection</mark> <mark>pool</mark>"; got.Results[1].Snippet != want {
+		t.Errorf("snippet = %q, want %q", got.Results[1].Snippet, want)
+	}
+
+	got = decode[NoteSearchResponse](t, serve(t, alice, "GET", `/api/notes/search?q="pool+connection"`, "", http.StatusOK))
+	if len(got.Results) != 0 {
+		t.Errorf("phrase in the wrong order matched %+v", got.Results)
+	}
+	got = decode[NoteSearchResponse](t, serve(t, alice, "GET", "/api/notes/search?q=connection&limit=1", "", http.StatusOK))
+	if len(got.Results) != 1 {
+		t.Errorf("limit=1 returned %d results", len(got.Results))
+	}
+
+	serve(t, alice, "POST", "/api/notes", `{"text":"<script>alert('pool')</script> & \"pool\""}`, http.StatusCreated)
+	got = decode[NoteSearchResponse](t, serve(t, alice, "GET", "/api/notes/search?q=alert", "", http.StatusOK))
+	want := "&lt;script&gt;<mark>alert</mark>(&#39;pool&#39;)&lt;/script&gt; &amp; &#34;pool&#34;"
+	if len(got.Results) != 1 || got.Results[0].Snippet != want {
+		t.Errorf("snippet of markup = %+v, want %q", got.Results, want)
+	}
+
+	serve(t, alice, "GET", "/api/notes/search?q=%26", "", http.StatusBadRequest)
+	serve(t, alice, "GET", "/api/notes/search?q=x&limit=0", "", http.StatusBadRequest)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// noteCursor points at the last note of a page. Pages are ordered by
+// (created_at, id) descending, so the next page starts strictly after it.
+type noteCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+func (c noteCursor) encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeNoteCursor(s string) (noteCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return noteCursor{}, errInvalidCursor
+	}
+
+	createdAt, idStr, found := strings.Cut(string(raw), ",")
+	if !found {
+		return noteCursor{}, errInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return noteCursor{}, errInvalidCursor
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return noteCursor{}, errInvalidCursor
+	}
+
+	return noteCursor{CreatedAt: t, ID: id}, nil
+}
+
+// parsePageParams reads limit and cursor from the query string. Limits above
+// maxPageSize are clamped rather than rejected.
+func parsePageParams(q url.Values) (int, *noteCursor, error) {
+	limit := defaultPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, nil, fmt.Errorf("invalid limit %q", v)
+		}
+		limit = min(n, maxPageSize)
+	}
+
+	var cursor *noteCursor
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeNoteCursor(v)
+		if err != nil {
+			return 0, nil, err
+		}
+		cursor = &c
+	}
+
+	return limit, cursor, nil
+}
+
+// newNotesPage trims notes, fetched with one row past limit, to a page and
+// sets the next page's cursor when that extra row exists.
+func newNotesPage(notes []Note, limit int) NotesPage {
+	page := NotesPage{Notes: notes}
+	if len(notes) > limit {
+		page.Notes = notes[:limit]
+		last := page.Notes[limit-1]
+		next := noteCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+		page.NextCursor = &next
+	}
+	return page
+}
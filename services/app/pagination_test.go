@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNoteCursorRoundTrip(t *testing.T) {
+	cursor := noteCursor{
+		CreatedAt: time.Date(2025, 3, 14, 15, 9, 26, 535897000, time.UTC),
+		ID:        42,
+	}
+
+	decoded, err := decodeNoteCursor(cursor.encode())
+	if err != nil {
+		t.Fatalf("decodeNoteCursor() error = %v", err)
+	}
+	if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("decodeNoteCursor() = %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestDecodeNoteCursorRejectsGarbage(t *testing.T) {
+	for _, s := range []string{"not base64!", "bm8tY29tbWE", "eCx5"} {
+		if _, err := decodeNoteCursor(s); err == nil {
+			t.Errorf("decodeNoteCursor(%q) expected error", s)
+		}
+	}
+}
+
+func TestParsePageParams(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantLimit int
+		wantErr   bool
+	}{
+		{"", defaultPageSize, false},
+		{"limit=5", 5, false},
+		{"limit=100000", maxPageSize, false},
+		{"limit=0", 0, true},
+		{"limit=abc", 0, true},
+		{"cursor=garbage!", 0, true},
+	}
+
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		limit, _, err := parsePageParams(q)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePageParams(%q) error = %v, wantErr %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && limit != tt.wantLimit {
+			t.Errorf("parsePageParams(%q) limit = %d, want %d", tt.query, limit, tt.wantLimit)
+		}
+	}
+}
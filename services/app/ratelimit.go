@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"infrastructure-training-back/internal/auth"
+	"infrastructure-training-back/internal/config"
+)
+
+var rateLimitedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limited_requests_total",
+	Help: "Requests rejected with 429 by route template.",
+}, []string{"route"})
+
+// rateLimitResult is the outcome of taking one request from an allowance.
+type rateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long a rejected client has to wait.
+	RetryAfter time.Duration
+	// Reset is how long until the full allowance is available again.
+	Reset time.Duration
+}
+
+// rateLimiter takes one request from key's allowance under limit.
+//
+// Both implementations use the generic cell rate algorithm: a key stores the
+// theoretical arrival time (TAT) of its next request, which every allowed
+// request pushes back by Window/Requests. A request is allowed while the TAT
+// stays within one Window of now, so a client may burst up to Requests and
+// then continues at the average rate.
+type rateLimiter interface {
+	Allow(ctx context.Context, key string, limit config.RateLimit) (rateLimitResult, error)
+}
+
+// gcraResult describes an allowed request, given how far ahead of now the
+// key's TAT is after taking it.
+func gcraResult(limit config.RateLimit, ahead time.Duration) rateLimitResult {
+	interval := limit.Window / time.Duration(limit.Requests)
+	return rateLimitResult{
+		Allowed:   true,
+		Remaining: int((limit.Window - ahead) / interval),
+		Reset:     ahead,
+	}
+}
+
+// memoryRateLimiter keeps TATs in process memory, so each process enforces
+// the limits on its own.
+type memoryRateLimiter struct {
+	mu        sync.Mutex
+	tats      map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{
+		tats: make(map[string]time.Time),
+		now:  time.Now,
+	}
+}
+
+func (l *memoryRateLimiter) Allow(_ context.Context, key string, limit config.RateLimit) (rateLimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	tat := l.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(limit.Window / time.Duration(limit.Requests))
+	if allowAt := next.Add(-limit.Window); allowAt.After(now) {
+		return rateLimitResult{RetryAfter: allowAt.Sub(now), Reset: tat.Sub(now)}, nil
+	}
+
+	l.tats[key] = next
+	return gcraResult(limit, next.Sub(now)), nil
+}
+
+// sweep drops keys whose allowance is full again, at most once a minute.
+func (l *memoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, tat := range l.tats {
+		if !tat.After(now) {
+			delete(l.tats, key)
+		}
+	}
+}
+
+// rateLimitMiddleware limits each client per route. Routes with an entry in
+// cfg.Routes get that limit, other /api/ routes get cfg.Default, and the rest
+// (probes and metrics) are not limited. It must run after authMiddleware so
+// API keys and users are told apart from anonymous clients.
+func rateLimitMiddleware(limiter rateLimiter, cfg config.RateLimitConfig) (mux.MiddlewareFunc, error) {
+	defaultLimit, err := config.ParseRateLimit(cfg.Default)
+	if err != nil {
+		return nil, err
+	}
+	routeLimits, err := cfg.RouteLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tmpl, ok := routeTemplate(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			name := r.Method + " " + tmpl
+			limit, ok := routeLimits[name]
+			if !ok && strings.HasPrefix(tmpl, "/api/") {
+				limit = defaultLimit
+			}
+			if limit.Requests == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := "ratelimit:" + name + ":" + rateLimitClient(r, cfg.TrustProxy)
+			if !takeRateLimit(w, r, limiter, key, limit, tmpl) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// ipRateLimitMiddleware limits each client address across all /api/ routes
+// to cfg.PerIP. It must run before authMiddleware, so a client guessing API
+// keys or tokens is throttled even though every attempt is rejected there.
+func ipRateLimitMiddleware(limiter rateLimiter, cfg config.RateLimitConfig) (mux.MiddlewareFunc, error) {
+	limit, err := config.ParseRateLimit(cfg.PerIP)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tmpl, ok := routeTemplate(r)
+			if !ok || limit.Requests == 0 || !strings.HasPrefix(tmpl, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := "ratelimit:per-ip:" + clientIP(r, cfg.TrustProxy)
+			if !takeRateLimit(w, r, limiter, key, limit, tmpl) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// routeTemplate returns the path template of the route r matched.
+func routeTemplate(r *http.Request) (string, bool) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", false
+	}
+	tmpl, err := route.GetPathTemplate()
+	if err != nil {
+		return "", false
+	}
+	return tmpl, true
+}
+
+// takeRateLimit takes one request from key's allowance and sets the
+// RateLimit headers. When the allowance is used up it responds 429 and
+// returns false. A failing limiter lets the request through.
+func takeRateLimit(w http.ResponseWriter, r *http.Request, limiter rateLimiter, key string, limit config.RateLimit, tmpl string) bool {
+	res, err := limiter.Allow(r.Context(), key, limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Rate limit check failed", "error", err)
+		return true
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	h.Set("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+strconv.Itoa(ceilSeconds(limit.Window)))
+
+	if !res.Allowed {
+		rateLimitedRequests.WithLabelValues(tmpl).Inc()
+		h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(res.RetryAfter))))
+		h.Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Rate limit exceeded"))
+		if err != nil {
+			return false
+		}
+		return false
+	}
+	return true
+}
+
+// rateLimitClient identifies who a request counts against: the API key or
+// user it was authenticated as, otherwise its address.
+func rateLimitClient(r *http.Request, trustProxy bool) string {
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		return "principal:" + url.QueryEscape(principal.Subject)
+	}
+	return "ip:" + clientIP(r, trustProxy)
+}
+
+// clientIP returns the address a request came from. IPv6 clients are
+// grouped by /64, which is what a single host usually gets.
+func clientIP(r *http.Request, trustProxy bool) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = h
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); trustProxy && forwarded != "" {
+		host = strings.TrimSpace(forwarded[strings.LastIndex(forwarded, ",")+1:])
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return url.QueryEscape(host)
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String()
+	}
+	return addr.String()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
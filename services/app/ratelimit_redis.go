@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"infrastructure-training-back/internal/config"
+)
+
+// redisRateLimitScript runs GCRA atomically on Redis's clock, so replicas
+// share one allowance per key regardless of their own clocks. Times are in
+// microseconds. It returns {allowed, retry after, TAT minus now}.
+var redisRateLimitScript = redis.NewScript(`
+local interval = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then
+	tat = now
+end
+
+local next_tat = tat + interval
+local allow_at = next_tat - window
+if allow_at > now then
+	return {0, allow_at - now, tat - now}
+end
+
+redis.call('SET', KEYS[1], string.format('%d', next_tat), 'PX', math.ceil((next_tat - now) / 1000))
+return {1, 0, next_tat - now}
+`)
+
+type redisRateLimiter struct {
+	rdb *redis.Client
+}
+
+func (l *redisRateLimiter) Allow(ctx context.Context, key string, limit config.RateLimit) (rateLimitResult, error) {
+	interval := limit.Window / time.Duration(limit.Requests)
+	res, err := redisRateLimitScript.Run(ctx, l.rdb, []string{key},
+		interval.Microseconds(), limit.Window.Microseconds()).Int64Slice()
+	if err != nil {
+		return rateLimitResult{}, err
+	}
+
+	ahead := time.Duration(res[2]) * time.Microsecond
+	if res[0] == 0 {
+		return rateLimitResult{RetryAfter: time.Duration(res[1]) * time.Microsecond, Reset: ahead}, nil
+	}
+	return gcraResult(limit, ahead), nil
+}
+
+// fallbackRateLimiter prefers Redis and falls back to process memory when a
+// Redis call fails, rather than letting every request through.
+type fallbackRateLimiter struct {
+	primary  rateLimiter
+	fallback rateLimiter
+}
+
+func (l fallbackRateLimiter) Allow(ctx context.Context, key string, limit config.RateLimit) (rateLimitResult, error) {
+	res, err := l.primary.Allow(ctx, key, limit)
+	if err == nil {
+		return res, nil
+	}
+	slog.WarnContext(ctx, "Rate limiting in process, Redis failed", "error", err)
+	return l.fallback.Allow(ctx, key, limit)
+}
+
+// newRateLimiter shares limits between replicas through rdb, or keeps them
+// in process when rdb is nil because Redis was unreachable at startup.
+func newRateLimiter(rdb *redis.Client) rateLimiter {
+	if rdb == nil {
+		slog.Warn("Rate limiting in process only, Redis is not connected")
+		return newMemoryRateLimiter()
+	}
+	return fallbackRateLimiter{primary: &redisRateLimiter{rdb: rdb}, fallback: newMemoryRateLimiter()}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"infrastructure-training-back/internal/auth"
+	"infrastructure-training-back/internal/config"
+)
+
+var threePerMinute = config.RateLimit{Requests: 3, Window: time.Minute}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	l := newMemoryRateLimiter()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for want := 2; want >= 0; want-- {
+		res, err := l.Allow(ctx, "k", threePerMinute)
+		if err != nil || !res.Allowed || res.Remaining != want {
+			t.Fatalf("burst: got %+v, %v, want allowed with %d remaining", res, err, want)
+		}
+	}
+
+	res, _ := l.Allow(ctx, "k", threePerMinute)
+	if res.Allowed || res.RetryAfter != 20*time.Second || res.Reset != time.Minute {
+		t.Fatalf("over limit: got %+v, want rejected, retry after 20s, reset 1m", res)
+	}
+	if res, _ := l.Allow(ctx, "other", threePerMinute); !res.Allowed {
+		t.Error("keys share an allowance")
+	}
+
+	// One request's worth of allowance comes back every 20s.
+	now = now.Add(20 * time.Second)
+	if res, _ := l.Allow(ctx, "k", threePerMinute); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after 20s: got %+v, want allowed with 0 remaining", res)
+	}
+
+	// Idle keys are dropped once their allowance is full again.
+	now = now.Add(2 * time.Minute)
+	l.Allow(ctx, "fresh", threePerMinute)
+	if _, ok := l.tats["k"]; ok {
+		t.Error("idle key was not swept")
+	}
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	rdb, prefix := testRedis(t)
+	l := &redisRateLimiter{rdb: rdb}
+	ctx := context.Background()
+
+	for want := 2; want >= 0; want-- {
+		res, err := l.Allow(ctx, prefix+"k", threePerMinute)
+		if err != nil || !res.Allowed || res.Remaining != want {
+			t.Fatalf("burst: got %+v, %v, want allowed with %d remaining", res, err, want)
+		}
+	}
+	res, err := l.Allow(ctx, prefix+"k", threePerMinute)
+	if err != nil || res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > 20*time.Second {
+		t.Fatalf("over limit: got %+v, %v, want rejected for at most 20s", res, err)
+	}
+
+	ttl, err := rdb.PTTL(ctx, prefix+"k").Result()
+	if err != nil || ttl <= 0 || ttl > time.Minute {
+		t.Errorf("key TTL = %v, %v, want within the window", ttl, err)
+	}
+}
+
+type failingRateLimiter struct{}
+
+func (failingRateLimiter) Allow(context.Context, string, config.RateLimit) (rateLimitResult, error) {
+	return rateLimitResult{}, errors.New("connection refused")
+}
+
+func TestFallbackRateLimiter(t *testing.T) {
+	l := fallbackRateLimiter{primary: failingRateLimiter{}, fallback: newMemoryRateLimiter()}
+
+	for i := 0; i < 3; i++ {
+		if res, err := l.Allow(context.Background(), "k", threePerMinute); err != nil || !res.Allowed {
+			t.Fatalf("request %d: %+v, %v", i, res, err)
+		}
+	}
+	if res, _ := l.Allow(context.Background(), "k", threePerMinute); res.Allowed {
+		t.Error("fallback did not enforce the limit")
+	}
+}
+
+func newRateLimitedRouter(t *testing.T, cfg config.RateLimitConfig) *mux.Router {
+	t.Helper()
+	limit, err := rateLimitMiddleware(newMemoryRateLimiter(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	r.Use(limit)
+	r.HandleFunc("/health", ok).Methods("GET")
+	r.HandleFunc("/api/notes", ok).Methods("GET", "POST")
+	r.HandleFunc("/api/notes/{id}", ok).Methods("GET")
+	return r
+}
+
+func rateLimitedRequest(r http.Handler, method, path, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	r := newRateLimitedRouter(t, config.RateLimitConfig{
+		Default: "3/1m",
+		Routes:  []string{"POST /api/notes=2/1m", "GET /api/notes/{id}=off"},
+	})
+	const client = "192.0.2.1:5000"
+
+	for i := 0; i < 2; i++ {
+		rr := rateLimitedRequest(r, "POST", "/api/notes", client)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("POST %d: code %d", i, rr.Code)
+		}
+		if got := rr.Header().Get("RateLimit-Remaining"); got != strconv.Itoa(1-i) {
+			t.Errorf("POST %d: RateLimit-Remaining = %q", i, got)
+		}
+	}
+
+	rr := rateLimitedRequest(r, "POST", "/api/notes", client)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("third POST: code %d, want 429", rr.Code)
+	}
+	for header, want := range map[string]string{
+		"Retry-After":         "30",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"RateLimit-Policy":    "2;w=60",
+		"Content-Type":        "application/json",
+	} {
+		if got := rr.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	resp := decode[ErrorResponse](t, rr)
+	if resp.Error != "Rate limit exceeded" || resp.RequestID == "" {
+		t.Errorf("429 body = %+v", resp)
+	}
+
+	// Other routes, methods and clients have allowances of their own.
+	if rr := rateLimitedRequest(r, "GET", "/api/notes", client); rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "3" {
+		t.Errorf("GET /api/notes: code %d, limit %q", rr.Code, rr.Header().Get("RateLimit-Limit"))
+	}
+	if rr := rateLimitedRequest(r, "POST", "/api/notes", "192.0.2.2:5000"); rr.Code != http.StatusOK {
+		t.Errorf("POST from another client: code %d", rr.Code)
+	}
+
+	// Routes turned off and routes outside /api/ are never limited.
+	for i := 0; i < 5; i++ {
+		for _, path := range []string{"/api/notes/1", "/health"} {
+			rr := rateLimitedRequest(r, "GET", path, client)
+			if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "" {
+				t.Fatalf("GET %s: code %d, limit %q", path, rr.Code, rr.Header().Get("RateLimit-Limit"))
+			}
+		}
+	}
+}
+
+func TestIPRateLimitMiddlewareRunsBeforeAuth(t *testing.T) {
+	limit, err := ipRateLimitMiddleware(newMemoryRateLimiter(), config.RateLimitConfig{PerIP: "2/1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reject := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}
+
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	r.Use(limit)
+	r.Use(reject)
+	r.HandleFunc("/health", ok).Methods("GET")
+	r.HandleFunc("/api/notes", ok).Methods("GET", "POST")
+	const client = "192.0.2.1:5000"
+
+	// Rejected attempts count, whatever route they go to.
+	for _, method := range []string{"GET", "POST"} {
+		if rr := rateLimitedRequest(r, method, "/api/notes", client); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: code %d, want 401", method, rr.Code)
+		}
+	}
+	rr := rateLimitedRequest(r, "GET", "/api/notes", client)
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("third attempt: code %d, policy %q, want 429", rr.Code, rr.Header().Get("RateLimit-Policy"))
+	}
+
+	if rr := rateLimitedRequest(r, "GET", "/api/notes", "192.0.2.2:5000"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("another client: code %d, want 401", rr.Code)
+	}
+	if rr := rateLimitedRequest(r, "GET", "/health", client); rr.Code != http.StatusUnauthorized || rr.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("GET /health: code %d, limit %q", rr.Code, rr.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimitClient(t *testing.T) {
+	withPrincipal := func(subject string) *http.Request {
+		req := httptest.NewRequest("GET", "/api/notes", nil)
+		return req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Subject: subject}))
+	}
+	withAddr := func(remote, forwarded string) *http.Request {
+		req := httptest.NewRequest("GET", "/api/notes", nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		trustProxy bool
+		want       string
+	}{
+		{"user", withPrincipal("alice"), false, "principal:alice"},
+		{"api key", withPrincipal("api-key:itb_0123abcd"), false, "principal:api-key%3Aitb_0123abcd"},
+		{"ipv4", withAddr("192.0.2.1:5000", ""), false, "ip:192.0.2.1"},
+		{"forwarded ignored", withAddr("10.0.0.1:5000", "192.0.2.1"), false, "ip:10.0.0.1"},
+		{"forwarded trusted", withAddr("10.0.0.1:5000", "198.51.100.7, 192.0.2.1"), true, "ip:192.0.2.1"},
+		{"ipv6 grouped by /64", withAddr("[2001:db8:1:2:aaaa::1]:5000", ""), false, "ip:2001:db8:1:2::/64"},
+		{"ipv4-mapped ipv6", withAddr("[::ffff:192.0.2.1]:5000", ""), false, "ip:192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rateLimitClient(tt.req, tt.trustProxy); got != tt.want {
+				t.Errorf("rateLimitClient() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,28 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
-	"os"
+	"net/url"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
-)
-
-func initRedis() *redis.Client {
-	redisHost := os.Getenv("REDIS_HOST")
-	if redisHost == "" {
-		redisHost = "localhost"
-	}
 
-	redisPort := os.Getenv("REDIS_PORT")
-	if redisPort == "" {
-		redisPort = "6379"
-	}
+	"infrastructure-training-back/internal/config"
+)
 
+func initRedis(cfg config.RedisConfig) *redis.Client {
 	rdb := redis.NewClient(&redis.Options{
-		Addr:     redisHost + ":" + redisPort,
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       0,
+		Addr:     cfg.Addr(),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+		// Also stop at the request context's deadline or cancellation.
+		ContextTimeoutEnabled: true,
 	})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -35,6 +36,66 @@ func initRedis() *redis.Client {
 		return nil
 	}
 
-	slog.Info("Connected to Redis", "addr", redisHost+":"+redisPort)
+	if err := redisotel.InstrumentTracing(rdb); err != nil {
+		slog.Warn("Failed to instrument Redis tracing", "error", err)
+	}
+
+	slog.Info("Connected to Redis", "addr", cfg.Addr())
 	return rdb
 }
+
+// Each user's cached note pages live under notes:user:<user id>:. A
+// per-user generation counter is part of every page key; bumping it
+// invalidates all of that user's pages at once, and stale pages simply
+// expire. The user id is escaped so that no id can reach into the keys of
+// another.
+func notesCachePrefix(userID string) string {
+	return "notes:user:" + url.QueryEscape(userID) + ":"
+}
+
+func notesCacheGenerationKey(userID string) string {
+	return notesCachePrefix(userID) + "generation"
+}
+
+// The cursor is base64url and cannot contain the ':' that separates it from
+// the filter.
+func notesPageCacheKey(ctx context.Context, rdb *redis.Client, userID string, limit int, cursor string, filter noteFilter) (string, error) {
+	generation, err := rdb.Get(ctx, notesCacheGenerationKey(userID)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return "", err
+	}
+	return fmt.Sprintf("%spage:%d:%d:%s:%s", notesCachePrefix(userID), generation, limit, cursor, filter.cacheKey()), nil
+}
+
+var notesCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "notes_cache_requests_total",
+	Help: "Notes page cache lookups by result: hit, miss or error.",
+}, []string{"result"})
+
+func recordNotesCacheLookup(err error) {
+	switch {
+	case err == nil:
+		notesCacheRequests.WithLabelValues("hit").Inc()
+	case errors.Is(err, redis.Nil):
+		notesCacheRequests.WithLabelValues("miss").Inc()
+	default:
+		notesCacheRequests.WithLabelValues("error").Inc()
+	}
+}
+
+func invalidateNotesCache(ctx context.Context, rdb *redis.Client, userID string) {
+	if err := rdb.Incr(ctx, notesCacheGenerationKey(userID)).Err(); err != nil {
+		slog.WarnContext(ctx, "Failed to invalidate cache", "error", err)
+	}
+}
+
+// redisCheck reports Redis as degraded unless cfg.Required is set. A nil
+// client means Redis was unreachable at startup and caching is disabled.
+func redisCheck(rdb *redis.Client, cfg config.RedisConfig) healthCheck {
+	return healthCheck{name: "redis", required: cfg.Required, run: func(ctx context.Context) error {
+		if rdb == nil {
+			return errors.New("not connected, caching disabled")
+		}
+		return rdb.Ping(ctx).Err()
+	}}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestNotesCachePrefixIsPerUser(t *testing.T) {
+	users := []string{"", "alice", "bob", "alice:page", "api-key:itb_0123abcd", "a b/c"}
+
+	seen := make(map[string]string)
+	for _, user := range users {
+		prefix := notesCachePrefix(user)
+		if other, ok := seen[prefix]; ok {
+			t.Errorf("users %q and %q share cache prefix %q", user, other, prefix)
+		}
+		seen[prefix] = user
+
+		// No prefix may be a prefix of another user's keys.
+		for _, other := range users {
+			if other != user && strings.HasPrefix(notesCacheGenerationKey(other), prefix) {
+				t.Errorf("key %q of %q is under the prefix of %q", notesCacheGenerationKey(other), other, user)
+			}
+		}
+	}
+}
+
+// testRedis returns a client for the Redis server named by TEST_REDIS_URL,
+// skipping the test when it is not set, and a prefix that keeps the test's
+// keys apart from other runs.
+func testRedis(t *testing.T) (*redis.Client, string) {
+	t.Helper()
+
+	addr := os.Getenv("TEST_REDIS_URL")
+	if addr == "" {
+		t.Skip("TEST_REDIS_URL is not set")
+	}
+	opts, err := redis.ParseURL(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb := redis.NewClient(opts)
+	t.Cleanup(func() { rdb.Close() })
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("Redis at TEST_REDIS_URL is unreachable: %v", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatal(err)
+	}
+	return rdb, "test:" + hex.EncodeToString(suffix) + ":"
+}
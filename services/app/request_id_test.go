@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"missing", "", false},
+		{"uuid from proxy", "3f2b9c1e-7d4a-4b8e-9c3f-0a1b2c3d4e5f", true},
+		{"trace style", "svc:gateway.42_a", true},
+		{"spaces", "not a valid id", false},
+		{"header injection", "abc\r\nSet-Cookie: x=1", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			handler := requestIDMiddleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				fromContext = requestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			echoed := rr.Header().Get(requestIDHeader)
+			if echoed == "" || echoed != fromContext {
+				t.Errorf("response header %q, context %q: want the same non-empty ID", echoed, fromContext)
+			}
+			if kept := echoed == tt.incoming; kept != tt.keep {
+				t.Errorf("incoming %q kept = %v, want %v", tt.incoming, kept, tt.keep)
+			}
+		})
+	}
+}
+
+func TestRequestIDInErrorBodyAndLogs(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(requestIDLogHandler{slog.NewJSONHandler(&logs, nil)}))
+	defer slog.SetDefault(previous)
+
+	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	r.Use(loggingMiddleware)
+	r.HandleFunc("/api/notes/{id}", getNoteHandler(nil)).Methods("GET")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/notes/abc", nil)
+	req.Header.Set(requestIDHeader, "req-123")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	var body ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RequestID != "req-123" || body.Error != "Invalid ID format" {
+		t.Errorf("error body = %+v, want the request ID", body)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), logs.String())
+	}
+	for _, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["request_id"] != "req-123" {
+			t.Errorf("log line without request_id: %s", line)
+		}
+	}
+}
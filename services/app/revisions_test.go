@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestNoteRevisions(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+
+	note := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"milk\neggs\n"}`, http.StatusCreated))
+	path := "/api/notes/" + strconv.Itoa(note.ID)
+	serve(t, r, "PUT", path, `{"text":"milk\neggs\nbread\n"}`, http.StatusOK)
+	serve(t, r, "PATCH", path, `{"text":"oat milk\neggs\nbread\n"}`, http.StatusOK)
+
+	revisions := decode[[]NoteRevision](t, serve(t, r, "GET", path+"/revisions", "", http.StatusOK))
+	if len(revisions) != 3 || revisions[0].Revision != 3 || revisions[2].Text != "milk\neggs\n" {
+		t.Fatalf("GET revisions = %+v", revisions)
+	}
+
+	second := decode[NoteRevision](t, serve(t, r, "GET", path+"/revisions/2", "", http.StatusOK))
+	if second.Revision != 2 || second.Text != "milk\neggs\nbread\n" {
+		t.Errorf("GET revision 2 = %+v", second)
+	}
+
+	diff := decode[NoteDiff](t, serve(t, r, "GET", path+"/diff?from=1&to=3", "", http.StatusOK))
+	want := "--- revisions/1\n+++ revisions/3\n@@ -1,2 +1,3 @@\n-milk\n+oat milk\n eggs\n+bread\n"
+	if diff.From != 1 || diff.To != 3 || diff.Diff != want {
+		t.Errorf("GET diff = %+v, want diff %q", diff, want)
+	}
+	if same := decode[NoteDiff](t, serve(t, r, "GET", path+"/diff?from=2&to=2", "", http.StatusOK)); same.Diff != "" {
+		t.Errorf("diff of a revision with itself = %q", same.Diff)
+	}
+
+	// Restoring adds the old text as a new revision.
+	restored := decode[Note](t, serve(t, r, "POST", path+"/revisions/1/restore", "", http.StatusOK))
+	if restored.Text != "milk\neggs\n" {
+		t.Errorf("restore = %+v", restored)
+	}
+	revisions = decode[[]NoteRevision](t, serve(t, r, "GET", path+"/revisions", "", http.StatusOK))
+	if len(revisions) != 4 || revisions[0].Revision != 4 || revisions[0].Text != "milk\neggs\n" {
+		t.Errorf("GET revisions after restore = %+v", revisions)
+	}
+}
+
+func TestNoteRevisionErrors(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+	note := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"x"}`, http.StatusCreated))
+	path := "/api/notes/" + strconv.Itoa(note.ID)
+
+	tests := []struct {
+		method, path string
+		code         int
+		error        string
+	}{
+		{"GET", "/api/notes/abc/revisions", http.StatusBadRequest, "Invalid ID format"},
+		{"GET", path + "/revisions/abc", http.StatusBadRequest, "Invalid ID format"},
+		{"GET", path + "/diff?from=1", http.StatusBadRequest, "Query parameters from and to must be revision numbers"},
+		{"GET", "/api/notes/999/revisions", http.StatusNotFound, "Note not found"},
+		{"GET", "/api/notes/999/revisions/1", http.StatusNotFound, "Note not found"},
+		{"GET", path + "/revisions/2", http.StatusNotFound, "Revision not found"},
+		{"GET", path + "/diff?from=1&to=2", http.StatusNotFound, "Revision not found"},
+		{"POST", path + "/revisions/0/restore", http.StatusNotFound, "Revision not found"},
+	}
+	for _, tt := range tests {
+		errBody := decode[ErrorResponse](t, serve(t, r, tt.method, tt.path, "", tt.code))
+		if errBody.Error != tt.error {
+			t.Errorf("%s %s: error = %q, want %q", tt.method, tt.path, errBody.Error, tt.error)
+		}
+	}
+
+	// Another user's and trashed notes have no visible history.
+	serve(t, asUser("bob", r), "GET", path+"/revisions", "", http.StatusNotFound)
+	serve(t, r, "DELETE", path, "", http.StatusOK)
+	serve(t, r, "GET", path+"/revisions", "", http.StatusNotFound)
+	serve(t, r, "POST", path+"/revisions/1/restore", "", http.StatusNotFound)
+}
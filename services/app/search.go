@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type NoteSearchResult struct {
+	Note
+	Rank float64 `json:"rank"`
+	// Snippet is HTML: the note text escaped, with matches in <mark> tags.
+	Snippet string `json:"snippet"`
+}
+
+type NoteSearchResponse struct {
+	Results []NoteSearchResult `json:"results"`
+}
+
+var errEmptySearchQuery = errors.New("search query has no searchable terms")
+
+// searchTerm is consecutive words matched as a phrase; with prefix set the
+// last word matches as a prefix.
+type searchTerm struct {
+	words  []string
+	prefix bool
+}
+
+// searchQuery holds the terms a note must all contain.
+type searchQuery struct {
+	terms []searchTerm
+}
+
+// parseSearchQuery reads user input. Quoted text becomes a phrase match, a
+// trailing * makes a prefix match and all terms must be present. Everything
+// except letters and digits separates words.
+func parseSearchQuery(input string) (searchQuery, error) {
+	var query searchQuery
+
+	rest := input
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			break
+		}
+
+		var token string
+		var phrase bool
+		if rest[0] == '"' {
+			rest = rest[1:]
+			end := strings.IndexByte(rest, '"')
+			if end < 0 {
+				end = len(rest)
+			}
+			token, rest = rest[:end], strings.TrimPrefix(rest[end:], `"`)
+			phrase = true
+		} else {
+			end := strings.IndexFunc(rest, func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+			if end < 0 {
+				end = len(rest)
+			}
+			token, rest = rest[:end], rest[end:]
+		}
+
+		words := searchWords(token)
+		if len(words) == 0 {
+			continue
+		}
+		query.terms = append(query.terms, searchTerm{
+			words:  words,
+			prefix: !phrase && strings.HasSuffix(token, "*"),
+		})
+	}
+
+	if len(query.terms) == 0 {
+		return searchQuery{}, errEmptySearchQuery
+	}
+	return query, nil
+}
+
+// searchWords splits s into lower-cased words the way the 'simple' text
+// search configuration does.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tsquery renders q as a to_tsquery expression. Only letters and digits
+// make it into the result, so it is always a valid tsquery.
+func (q searchQuery) tsquery() string {
+	terms := make([]string, 0, len(q.terms))
+	for _, term := range q.terms {
+		words := strings.Join(term.words, " <-> ")
+		if term.prefix {
+			words += ":*"
+		}
+		terms = append(terms, words)
+	}
+	return strings.Join(terms, " & ")
+}
+
+func searchNotesHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		query, err := parseSearchQuery(r.URL.Query().Get("q"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Query parameter q is required"))
+			if err != nil {
+				return
+			}
+			return
+		}
+
+		limit := defaultPageSize
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				err := json.NewEncoder(w).Encode(newErrorResponse(r.Context(), "Invalid limit"))
+				if err != nil {
+					return
+				}
+				return
+			}
+			limit = min(n, maxPageSize)
+		}
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		results, err := store.Search(queryCtx, noteOwner(r.Context()), query, limit)
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(NoteSearchResponse{Results: results})
+		if err != nil {
+			return
+		}
+	}
+}
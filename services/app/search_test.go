@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSearchQueryTSQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"redis", "redis"},
+		{"redis cache", "redis & cache"},
+		{`"connection pool" postgres`, "connection <-> pool & postgres"},
+		{"migr*", "migr:*"},
+		{`"full text" sea*`, "full <-> text & sea:*"},
+		{"заметка", "заметка"},
+		{"it's & | ! (x)", "it <-> s & x"},
+		{`"unterminated phrase`, "unterminated <-> phrase"},
+	}
+
+	for _, tt := range tests {
+		query, err := parseSearchQuery(tt.input)
+		if err != nil {
+			t.Errorf("parseSearchQuery(%q) error = %v", tt.input, err)
+			continue
+		}
+		if got := query.tsquery(); got != tt.want {
+			t.Errorf("parseSearchQuery(%q).tsquery() = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchQueryEmpty(t *testing.T) {
+	for _, input := range []string{"", "   ", `""`, "& | !"} {
+		if _, err := parseSearchQuery(input); !errors.Is(err, errEmptySearchQuery) {
+			t.Errorf("parseSearchQuery(%q) error = %v, want %v", input, err, errEmptySearchQuery)
+		}
+	}
+}
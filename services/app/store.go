@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	errNoteNotFound     = errors.New("note not found")
+	errRevisionNotFound = errors.New("revision not found")
+)
+
+// noteChanges holds the fields an Update sets; nil fields keep their value.
+// Tags replace the note's tags as a whole.
+type noteChanges struct {
+	Text *string
+	Tags *[]string
+}
+
+// NoteStore persists notes. Every method acts on the notes of userID only:
+// Get, Update and Delete return errNoteNotFound for an unknown id and for a
+// note of another user alike, so callers cannot probe for foreign ids.
+//
+// Delete moves a note to the trash rather than removing it. Trashed notes are
+// invisible to Get, List and Update until restored; only Purge removes a
+// note for good, and only once it is in the trash.
+type NoteStore interface {
+	// Create takes tags already normalized by normalizeTags, as Update does.
+	Create(ctx context.Context, userID, text string, tags []string) (Note, error)
+	Get(ctx context.Context, userID string, id int) (Note, error)
+	// List returns up to limit notes matching filter, newest first,
+	// starting after cursor when it is non-nil.
+	List(ctx context.Context, userID string, filter noteFilter, limit int, cursor *noteCursor) (NotesPage, error)
+	Update(ctx context.Context, userID string, id int, changes noteChanges) (Note, error)
+	// Search returns up to limit notes outside the trash containing every
+	// term of query, best match first.
+	Search(ctx context.Context, userID string, query searchQuery, limit int) ([]NoteSearchResult, error)
+	Delete(ctx context.Context, userID string, id int) error
+	// Trash pages through trashed notes in the same order as List.
+	Trash(ctx context.Context, userID string, limit int, cursor *noteCursor) (NotesPage, error)
+	// Restore and Purge return errNoteNotFound for notes not in the trash.
+	Restore(ctx context.Context, userID string, id int) (Note, error)
+	Purge(ctx context.Context, userID string, id int) error
+	// Revisions returns the history of note id, newest first. Create and
+	// every Update that changes the text each add a revision.
+	Revisions(ctx context.Context, userID string, id int) ([]NoteRevision, error)
+	// Revision returns errRevisionNotFound for an unknown revision of a
+	// note the user can see.
+	Revision(ctx context.Context, userID string, id, revision int) (NoteRevision, error)
+	// Tags counts the user's notes outside the trash per tag, by name.
+	// Tags no such note carries are left out.
+	Tags(ctx context.Context, userID string) ([]TagCount, error)
+}
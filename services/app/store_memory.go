@@ -0,0 +1,392 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"html"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// memoryNoteStore is a NoteStore kept in a map, used by tests and handy for
+// running the API without a database. It orders and pages notes the same
+// way as the Postgres store.
+type memoryNoteStore struct {
+	mu     sync.Mutex
+	notes  map[int]Note
+	owners map[int]string
+	// revisions holds each note's history, oldest first.
+	revisions map[int][]NoteRevision
+	nextID    int
+	// now is replaceable so tests can control timestamps.
+	now func() time.Time
+}
+
+func newMemoryNoteStore() *memoryNoteStore {
+	return &memoryNoteStore{
+		notes:     make(map[int]Note),
+		owners:    make(map[int]string),
+		revisions: make(map[int][]NoteRevision),
+		nextID:    1,
+		now:       time.Now,
+	}
+}
+
+func (s *memoryNoteStore) Create(ctx context.Context, userID, text string, tags []string) (Note, error) {
+	if err := ctx.Err(); err != nil {
+		return Note{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC()
+	note := Note{ID: s.nextID, Text: text, CreatedAt: now, UpdatedAt: now, Tags: append([]string{}, tags...)}
+	s.notes[note.ID] = note
+	s.owners[note.ID] = userID
+	s.addRevision(note)
+	s.nextID++
+	return note, nil
+}
+
+func (s *memoryNoteStore) Get(ctx context.Context, userID string, id int) (Note, error) {
+	if err := ctx.Err(); err != nil {
+		return Note{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok || s.owners[id] != userID || note.DeletedAt != nil {
+		return Note{}, errNoteNotFound
+	}
+	return note, nil
+}
+
+func (s *memoryNoteStore) List(ctx context.Context, userID string, filter noteFilter, limit int, cursor *noteCursor) (NotesPage, error) {
+	return s.page(ctx, false, userID, filter, limit, cursor)
+}
+
+func (s *memoryNoteStore) Trash(ctx context.Context, userID string, limit int, cursor *noteCursor) (NotesPage, error) {
+	return s.page(ctx, true, userID, noteFilter{}, limit, cursor)
+}
+
+func (s *memoryNoteStore) page(ctx context.Context, trashed bool, userID string, filter noteFilter, limit int, cursor *noteCursor) (NotesPage, error) {
+	if err := ctx.Err(); err != nil {
+		return NotesPage{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notes := make([]Note, 0, len(s.notes))
+	for id, note := range s.notes {
+		if s.owners[id] != userID || (note.DeletedAt != nil) != trashed || !filter.matches(note) {
+			continue
+		}
+		if cursor == nil || noteBefore(note, cursor.CreatedAt, cursor.ID) {
+			notes = append(notes, note)
+		}
+	}
+	slices.SortFunc(notes, func(a, b Note) int {
+		switch {
+		case noteBefore(a, b.CreatedAt, b.ID):
+			return 1
+		case noteBefore(b, a.CreatedAt, a.ID):
+			return -1
+		}
+		return 0
+	})
+	if len(notes) > limit+1 {
+		notes = notes[:limit+1]
+	}
+
+	return newNotesPage(notes, limit), nil
+}
+
+func (s *memoryNoteStore) Update(ctx context.Context, userID string, id int, changes noteChanges) (Note, error) {
+	if err := ctx.Err(); err != nil {
+		return Note{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok || s.owners[id] != userID || note.DeletedAt != nil {
+		return Note{}, errNoteNotFound
+	}
+	changed := changes.Text != nil && note.Text != *changes.Text
+	if changes.Text != nil {
+		note.Text = *changes.Text
+	}
+	if changes.Tags != nil {
+		note.Tags = append([]string{}, *changes.Tags...)
+	}
+	note.UpdatedAt = s.now().UTC()
+	s.notes[id] = note
+	if changed {
+		s.addRevision(note)
+	}
+	return note, nil
+}
+
+func (s *memoryNoteStore) Delete(ctx context.Context, userID string, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok || s.owners[id] != userID || note.DeletedAt != nil {
+		return errNoteNotFound
+	}
+	now := s.now().UTC()
+	note.DeletedAt = &now
+	note.UpdatedAt = now
+	s.notes[id] = note
+	return nil
+}
+
+func (s *memoryNoteStore) Restore(ctx context.Context, userID string, id int) (Note, error) {
+	if err := ctx.Err(); err != nil {
+		return Note{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok || s.owners[id] != userID || note.DeletedAt == nil {
+		return Note{}, errNoteNotFound
+	}
+	note.DeletedAt = nil
+	note.UpdatedAt = s.now().UTC()
+	s.notes[id] = note
+	return note, nil
+}
+
+func (s *memoryNoteStore) Purge(ctx context.Context, userID string, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok || s.owners[id] != userID || note.DeletedAt == nil {
+		return errNoteNotFound
+	}
+	delete(s.notes, id)
+	delete(s.owners, id)
+	delete(s.revisions, id)
+	return nil
+}
+
+func (s *memoryNoteStore) Revisions(ctx context.Context, userID string, id int) ([]NoteRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok || s.owners[id] != userID || note.DeletedAt != nil {
+		return nil, errNoteNotFound
+	}
+	revisions := slices.Clone(s.revisions[id])
+	slices.Reverse(revisions)
+	return revisions, nil
+}
+
+func (s *memoryNoteStore) Revision(ctx context.Context, userID string, id, revision int) (NoteRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return NoteRevision{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	note, ok := s.notes[id]
+	if !ok || s.owners[id] != userID || note.DeletedAt != nil {
+		return NoteRevision{}, errNoteNotFound
+	}
+	history := s.revisions[id]
+	if revision < 1 || revision > len(history) {
+		return NoteRevision{}, errRevisionNotFound
+	}
+	return history[revision-1], nil
+}
+
+func (s *memoryNoteStore) Tags(ctx context.Context, userID string) ([]TagCount, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int)
+	for id, note := range s.notes {
+		if s.owners[id] != userID || note.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range note.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, TagCount{Name: name, Count: count})
+	}
+	slices.SortFunc(tags, func(a, b TagCount) int { return strings.Compare(a.Name, b.Name) })
+	return tags, nil
+}
+
+// Search ranks notes by how often the query terms occur and marks them in
+// the snippet, a rough stand-in for ts_rank and ts_headline.
+func (s *memoryNoteStore) Search(ctx context.Context, userID string, query searchQuery, limit int) ([]NoteSearchResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := []NoteSearchResult{}
+	for id, note := range s.notes {
+		if s.owners[id] != userID || note.DeletedAt != nil {
+			continue
+		}
+		if rank, snippet, ok := query.match(note.Text); ok {
+			results = append(results, NoteSearchResult{Note: note, Rank: rank, Snippet: snippet})
+		}
+	}
+	slices.SortFunc(results, func(a, b NoteSearchResult) int {
+		if a.Rank != b.Rank {
+			return cmp.Compare(b.Rank, a.Rank)
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// match reports whether text contains every term of q. rank counts the term
+// occurrences and snippet is text with the matched words in <mark> tags.
+func (q searchQuery) match(text string) (rank float64, snippet string, ok bool) {
+	words := wordSpans(text)
+	marked := make([]bool, len(words))
+	for _, term := range q.terms {
+		found := false
+		for i := 0; i+len(term.words) <= len(words); i++ {
+			if !term.matchesAt(text, words[i:]) {
+				continue
+			}
+			found = true
+			rank++
+			for j := range term.words {
+				marked[i+j] = true
+			}
+		}
+		if !found {
+			return 0, "", false
+		}
+	}
+
+	var sb strings.Builder
+	last := 0
+	for i, span := range words {
+		if marked[i] {
+			sb.WriteString(html.EscapeString(text[last:span[0]]))
+			sb.WriteString("<mark>" + html.EscapeString(text[span[0]:span[1]]) + "</mark>")
+			last = span[1]
+		}
+	}
+	sb.WriteString(html.EscapeString(text[last:]))
+	return rank, sb.String(), true
+}
+
+// matchesAt reports whether t matches the words starting at spans[0].
+func (t searchTerm) matchesAt(text string, spans [][2]int) bool {
+	for j, want := range t.words {
+		word := strings.ToLower(text[spans[j][0]:spans[j][1]])
+		if j == len(t.words)-1 && t.prefix {
+			if !strings.HasPrefix(word, want) {
+				return false
+			}
+		} else if word != want {
+			return false
+		}
+	}
+	return true
+}
+
+// wordSpans returns the byte ranges of the words of text, split as
+// searchWords splits them.
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// matches reports whether note passes f, as the tag conditions of the
+// Postgres store's page query do.
+func (f noteFilter) matches(note Note) bool {
+	if len(f.Tags) == 0 {
+		return true
+	}
+	matched := 0
+	for _, tag := range f.Tags {
+		if slices.Contains(note.Tags, tag) {
+			matched++
+		}
+	}
+	if f.MatchAll {
+		return matched == len(f.Tags)
+	}
+	return matched > 0
+}
+
+// addRevision appends the current text of note to its history, as the
+// record_note_revision trigger does in Postgres. s.mu must be held.
+func (s *memoryNoteStore) addRevision(note Note) {
+	s.revisions[note.ID] = append(s.revisions[note.ID], NoteRevision{
+		Revision:  len(s.revisions[note.ID]) + 1,
+		Text:      note.Text,
+		CreatedAt: note.UpdatedAt,
+	})
+}
+
+// noteBefore reports whether note sorts after (createdAt, id) in the
+// newest-first order, matching (created_at, id) < ($1, $2) in SQL.
+func noteBefore(note Note, createdAt time.Time, id int) bool {
+	if !note.CreatedAt.Equal(createdAt) {
+		return note.CreatedAt.Before(createdAt)
+	}
+	return note.ID < id
+}
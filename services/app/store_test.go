@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testNoteStore checks the behaviour handlers rely on from every NoteStore.
+func testNoteStore(t *testing.T, store NoteStore) {
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "alice", 1_000_000); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Get(unknown) error = %v, want errNoteNotFound", err)
+	}
+	if _, err := store.Update(ctx, "alice", 1_000_000, textChange("x")); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Update(unknown) error = %v, want errNoteNotFound", err)
+	}
+	if err := store.Delete(ctx, "alice", 1_000_000); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Delete(unknown) error = %v, want errNoteNotFound", err)
+	}
+
+	var created []Note
+	for _, text := range []string{"first", "second", "third", "fourth", "fifth"} {
+		note, err := store.Create(ctx, "alice", text, nil)
+		if err != nil {
+			t.Fatalf("Create(%q) error = %v", text, err)
+		}
+		if note.ID == 0 || note.Text != text || note.CreatedAt.IsZero() {
+			t.Errorf("Create(%q) = %+v", text, note)
+		}
+		created = append(created, note)
+	}
+
+	got, err := store.Get(ctx, "alice", created[0].ID)
+	if err != nil || got.Text != "first" {
+		t.Errorf("Get() = %+v, %v", got, err)
+	}
+
+	updated, err := store.Update(ctx, "alice", created[1].ID, textChange("second, edited"))
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated.Text != "second, edited" || !updated.CreatedAt.Equal(created[1].CreatedAt) {
+		t.Errorf("Update() = %+v", updated)
+	}
+
+	// Creating and changing the text are recorded; unchanged text is not.
+	if _, err := store.Update(ctx, "alice", created[1].ID, textChange("second, edited")); err != nil {
+		t.Fatalf("Update(same text) error = %v", err)
+	}
+	revisions, err := store.Revisions(ctx, "alice", created[1].ID)
+	if err != nil {
+		t.Fatalf("Revisions() error = %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 2 || revisions[0].Text != "second, edited" ||
+		revisions[1].Revision != 1 || revisions[1].Text != "second" {
+		t.Errorf("Revisions() = %+v", revisions)
+	}
+	if revision, err := store.Revision(ctx, "alice", created[1].ID, 1); err != nil || revision.Text != "second" {
+		t.Errorf("Revision(1) = %+v, %v", revision, err)
+	}
+	if _, err := store.Revision(ctx, "alice", created[1].ID, 3); !errors.Is(err, errRevisionNotFound) {
+		t.Errorf("Revision(unknown) error = %v, want errRevisionNotFound", err)
+	}
+	if _, err := store.Revisions(ctx, "alice", 1_000_000); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Revisions(unknown note) error = %v, want errNoteNotFound", err)
+	}
+
+	if err := store.Delete(ctx, "alice", created[2].ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "alice", created[2].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Get(deleted) error = %v, want errNoteNotFound", err)
+	}
+	if _, err := store.Update(ctx, "alice", created[2].ID, textChange("x")); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Update(deleted) error = %v, want errNoteNotFound", err)
+	}
+	if _, err := store.Revisions(ctx, "alice", created[2].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Revisions(deleted) error = %v, want errNoteNotFound", err)
+	}
+	if err := store.Delete(ctx, "alice", created[2].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Delete(deleted) error = %v, want errNoteNotFound", err)
+	}
+
+	// Walk every page; notes come newest first with no gaps or repeats.
+	var listed []string
+	var cursor *noteCursor
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("pagination does not terminate")
+		}
+		page, err := store.List(ctx, "alice", noteFilter{}, 2, cursor)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		for _, note := range page.Notes {
+			listed = append(listed, note.Text)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		next, err := decodeNoteCursor(*page.NextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor = &next
+	}
+
+	want := []string{"fifth", "fourth", "second, edited", "first"}
+	if len(listed) != len(want) {
+		t.Fatalf("listed %v, want %v", listed, want)
+	}
+	for i := range want {
+		if listed[i] != want[i] {
+			t.Fatalf("listed %v, want %v", listed, want)
+		}
+	}
+
+	query, err := parseSearchQuery("fifth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, err := store.Search(ctx, "alice", query, 10); err != nil || len(results) != 1 || results[0].ID != created[4].ID {
+		t.Errorf("Search(fifth) = %+v, %v", results, err)
+	}
+	if results, err := store.Search(ctx, "bob", query, 10); err != nil || len(results) != 0 {
+		t.Errorf("Search(other user) = %+v, %v", results, err)
+	}
+
+	// Snippets are HTML, so the note text in them is escaped.
+	if _, err := store.Create(ctx, "mallory", `<img src=x onerror=alert(1)> fifth`, nil); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	results, err := store.Search(ctx, "mallory", query, 10)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("Search(markup) = %+v, %v", results, err)
+	}
+	if snippet := results[0].Snippet; strings.Contains(snippet, "<img") || !strings.Contains(snippet, "&lt;img") ||
+		!strings.Contains(snippet, "<mark>fifth</mark>") {
+		t.Errorf("Search(markup) snippet = %q", snippet)
+	}
+
+	// Deleted notes wait in the trash until restored or purged.
+	if err := store.Delete(ctx, "alice", created[0].ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	trash, err := store.Trash(ctx, "alice", 10, nil)
+	if err != nil {
+		t.Fatalf("Trash() error = %v", err)
+	}
+	if len(trash.Notes) != 2 || trash.Notes[0].Text != "third" || trash.Notes[1].Text != "first" || trash.Notes[0].DeletedAt == nil {
+		t.Errorf("Trash() = %+v", trash.Notes)
+	}
+	if _, err := store.Restore(ctx, "alice", created[1].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Restore(live note) error = %v, want errNoteNotFound", err)
+	}
+	if err := store.Purge(ctx, "alice", created[1].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Purge(live note) error = %v, want errNoteNotFound", err)
+	}
+	restored, err := store.Restore(ctx, "alice", created[0].ID)
+	if err != nil || restored.Text != "first" || restored.DeletedAt != nil {
+		t.Errorf("Restore() = %+v, %v", restored, err)
+	}
+	if err := store.Purge(ctx, "alice", created[2].ID); err != nil {
+		t.Errorf("Purge() error = %v", err)
+	}
+	if _, err := store.Restore(ctx, "alice", created[2].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Restore(purged) error = %v, want errNoteNotFound", err)
+	}
+	if trash, err := store.Trash(ctx, "alice", 10, nil); err != nil || len(trash.Notes) != 0 {
+		t.Errorf("Trash() after restore and purge = %+v, %v", trash, err)
+	}
+
+	// Another user sees none of it and cannot tell the ids exist.
+	if _, err := store.Get(ctx, "bob", created[0].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Get(other user) error = %v, want errNoteNotFound", err)
+	}
+	if _, err := store.Update(ctx, "bob", created[0].ID, textChange("mine now")); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Update(other user) error = %v, want errNoteNotFound", err)
+	}
+	if err := store.Delete(ctx, "bob", created[0].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Delete(other user) error = %v, want errNoteNotFound", err)
+	}
+	if _, err := store.Revisions(ctx, "bob", created[0].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Revisions(other user) error = %v, want errNoteNotFound", err)
+	}
+	if _, err := store.Revision(ctx, "bob", created[0].ID, 1); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Revision(other user) error = %v, want errNoteNotFound", err)
+	}
+	if err := store.Delete(ctx, "alice", created[3].ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Restore(ctx, "bob", created[3].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Restore(other user) error = %v, want errNoteNotFound", err)
+	}
+	if err := store.Purge(ctx, "bob", created[3].ID); !errors.Is(err, errNoteNotFound) {
+		t.Errorf("Purge(other user) error = %v, want errNoteNotFound", err)
+	}
+	page, err := store.List(ctx, "bob", noteFilter{}, 10, nil)
+	if err != nil || len(page.Notes) != 0 {
+		t.Errorf("List(other user) = %+v, %v", page, err)
+	}
+	trash, err = store.Trash(ctx, "bob", 10, nil)
+	if err != nil || len(trash.Notes) != 0 {
+		t.Errorf("Trash(other user) = %+v, %v", trash, err)
+	}
+	if got, err := store.Get(ctx, "alice", created[0].ID); err != nil || got.Text != "first" {
+		t.Errorf("Get() after other user's attempts = %+v, %v", got, err)
+	}
+}
+
+// testNoteStoreTags checks tag assignment, filtering and counting. It uses
+// its own user, so it can share a store with testNoteStore.
+func testNoteStoreTags(t *testing.T, store NoteStore) {
+	ctx := context.Background()
+
+	recipe, err := store.Create(ctx, "carol", "pancakes", []string{"cooking", "weekend"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !slices.Equal(recipe.Tags, []string{"cooking", "weekend"}) {
+		t.Errorf("Create() tags = %v", recipe.Tags)
+	}
+	untagged, err := store.Create(ctx, "carol", "call mum", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if untagged.Tags == nil || len(untagged.Tags) != 0 {
+		t.Errorf("Create() without tags: tags = %#v, want empty", untagged.Tags)
+	}
+	hike, err := store.Create(ctx, "carol", "hike", []string{"weekend"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	// The same tag name of another user is a separate tag.
+	if _, err := store.Create(ctx, "dave", "bbq", []string{"cooking"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	listed := func(filter noteFilter) []int {
+		t.Helper()
+		page, err := store.List(ctx, "carol", filter, 10, nil)
+		if err != nil {
+			t.Fatalf("List(%+v) error = %v", filter, err)
+		}
+		var ids []int
+		for _, note := range page.Notes {
+			ids = append(ids, note.ID)
+		}
+		return ids
+	}
+	if got := listed(noteFilter{Tags: []string{"cooking", "weekend"}}); !slices.Equal(got, []int{hike.ID, recipe.ID}) {
+		t.Errorf("List(any cooking, weekend) = %v", got)
+	}
+	if got := listed(noteFilter{Tags: []string{"cooking", "weekend"}, MatchAll: true}); !slices.Equal(got, []int{recipe.ID}) {
+		t.Errorf("List(all cooking, weekend) = %v", got)
+	}
+	if got := listed(noteFilter{Tags: []string{"nope"}}); len(got) != 0 {
+		t.Errorf("List(unknown tag) = %v", got)
+	}
+
+	// Text-only updates keep the tags; tag updates replace them.
+	updated, err := store.Update(ctx, "carol", recipe.ID, textChange("waffles"))
+	if err != nil || !slices.Equal(updated.Tags, []string{"cooking", "weekend"}) {
+		t.Errorf("Update(text) = %+v, %v", updated, err)
+	}
+	tags := []string{"cooking"}
+	updated, err = store.Update(ctx, "carol", recipe.ID, noteChanges{Tags: &tags})
+	if err != nil || updated.Text != "waffles" || !slices.Equal(updated.Tags, tags) {
+		t.Errorf("Update(tags) = %+v, %v", updated, err)
+	}
+	if got, err := store.Get(ctx, "carol", recipe.ID); err != nil || !slices.Equal(got.Tags, tags) {
+		t.Errorf("Get() after tag update = %+v, %v", got, err)
+	}
+
+	if err := store.Delete(ctx, "carol", hike.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	counts, err := store.Tags(ctx, "carol")
+	if err != nil {
+		t.Fatalf("Tags() error = %v", err)
+	}
+	if want := []TagCount{{Name: "cooking", Count: 1}}; !slices.Equal(counts, want) {
+		t.Errorf("Tags() = %+v, want %+v (trashed notes do not count)", counts, want)
+	}
+}
+
+func TestMemoryNoteStore(t *testing.T) {
+	store := newMemoryNoteStore()
+	testNoteStore(t, store)
+	testNoteStoreTags(t, store)
+}
+
+func TestMemoryNoteStoreOrdersEqualTimestampsByID(t *testing.T) {
+	store := newMemoryNoteStore()
+	fixed := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return fixed }
+
+	testNoteStore(t, store)
+}
+
+func TestMemoryNoteStoreHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := newMemoryNoteStore().Create(ctx, "", "x", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Create() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestPostgresNoteStore(t *testing.T) {
+	store := newPostgresNoteStore(testDB(t))
+	testNoteStore(t, store)
+	testNoteStoreTags(t, store)
+}
+
+// textChange is the noteChanges of an update that only sets the text.
+func textChange(text string) noteChanges {
+	return noteChanges{Text: &text}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxTagsPerNote = 20
+	maxTagLength   = 50
+)
+
+var errInvalidTagFilter = errors.New("invalid tag filter")
+
+// TagCount is one entry of GET /api/tags: a tag and how many of the user's
+// notes outside the trash carry it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// normalizeTags trims and lower-cases tags, drops duplicates and sorts them,
+// so "Go" and "go " are the same tag. It returns a client-facing problem with
+// tags, or "".
+func normalizeTags(tags []string) ([]string, string) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, "Tags must not be empty"
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, "Tags must be at most " + strconv.Itoa(maxTagLength) + " characters"
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > maxTagsPerNote {
+		return nil, "A note can have at most " + strconv.Itoa(maxTagsPerNote) + " tags"
+	}
+	return normalized, ""
+}
+
+// noteFilter narrows a notes listing to notes carrying any of Tags, or all of
+// them with MatchAll. No tags means no filtering.
+type noteFilter struct {
+	Tags     []string
+	MatchAll bool
+}
+
+// parseNoteFilter reads ?tag=a&tag=b and match=any (the default) or
+// match=all from the query string.
+func parseNoteFilter(q url.Values) (noteFilter, error) {
+	tags, problem := normalizeTags(q["tag"])
+	if problem != "" {
+		return noteFilter{}, errInvalidTagFilter
+	}
+
+	filter := noteFilter{Tags: tags}
+	switch q.Get("match") {
+	case "", "any":
+	case "all":
+		filter.MatchAll = true
+	default:
+		return noteFilter{}, errInvalidTagFilter
+	}
+	return filter, nil
+}
+
+// cacheKey identifies the filter within a notes page cache key. Equal
+// filters give equal keys since tags are normalized.
+func (f noteFilter) cacheKey() string {
+	if len(f.Tags) == 0 {
+		return ""
+	}
+	q := url.Values{"tag": f.Tags}
+	if f.MatchAll {
+		q.Set("match", "all")
+	}
+	return q.Encode()
+}
+
+func getTagsHandler(store NoteStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		queryCtx, cancel := withQueryTimeout(r.Context())
+		defer cancel()
+
+		tags, err := store.Tags(queryCtx, noteOwner(r.Context()))
+		if err != nil {
+			writeDatabaseError(queryCtx, w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(tags)
+		if err != nil {
+			return
+		}
+	}
+}
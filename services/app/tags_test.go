@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		problem string
+	}{
+		{"none", nil, []string{}, ""},
+		{"trimmed, lower-cased, sorted and deduplicated", []string{" Work", "home", "work "}, []string{"home", "work"}, ""},
+		{"empty", []string{"work", " "}, nil, "Tags must not be empty"},
+		{"too long", []string{strings.Repeat("ж", maxTagLength+1)}, nil, "Tags must be at most 50 characters"},
+		{"longest", []string{strings.Repeat("ж", maxTagLength)}, []string{strings.Repeat("ж", maxTagLength)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, problem := normalizeTags(tt.tags)
+			if problem != tt.problem || !slices.Equal(got, tt.want) {
+				t.Errorf("normalizeTags(%q) = %q, %q; want %q, %q", tt.tags, got, problem, tt.want, tt.problem)
+			}
+		})
+	}
+
+	many := make([]string, maxTagsPerNote+1)
+	for i := range many {
+		many[i] = "t" + strconv.Itoa(i)
+	}
+	if _, problem := normalizeTags(many); problem != "A note can have at most 20 tags" {
+		t.Errorf("normalizeTags(%d tags) problem = %q", len(many), problem)
+	}
+}
+
+func TestParseNoteFilter(t *testing.T) {
+	filter, err := parseNoteFilter(url.Values{"tag": {"Work", "home"}, "match": {"all"}})
+	if err != nil || !slices.Equal(filter.Tags, []string{"home", "work"}) || !filter.MatchAll {
+		t.Errorf("parseNoteFilter() = %+v, %v", filter, err)
+	}
+	for _, q := range []string{"match=some", "tag=", "tag=" + strings.Repeat("x", maxTagLength+1)} {
+		values, _ := url.ParseQuery(q)
+		if _, err := parseNoteFilter(values); err != errInvalidTagFilter {
+			t.Errorf("parseNoteFilter(%s) error = %v, want errInvalidTagFilter", q, err)
+		}
+	}
+
+	// Equal filters share cache entries; different ones do not.
+	a, _ := parseNoteFilter(url.Values{"tag": {"b", "A"}})
+	b, _ := parseNoteFilter(url.Values{"tag": {"a", "b", "a"}, "match": {"any"}})
+	c, _ := parseNoteFilter(url.Values{"tag": {"a", "b"}, "match": {"all"}})
+	if a.cacheKey() != b.cacheKey() || a.cacheKey() == c.cacheKey() || (noteFilter{}).cacheKey() != "" {
+		t.Errorf("cache keys: %q, %q, %q", a.cacheKey(), b.cacheKey(), c.cacheKey())
+	}
+}
+
+func TestNoteTags(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+
+	created := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"groceries","tags":["Home","errands"]}`, http.StatusCreated))
+	if !slices.Equal(created.Tags, []string{"errands", "home"}) {
+		t.Errorf("POST tags = %v", created.Tags)
+	}
+	work := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"report","tags":["work"]}`, http.StatusCreated))
+	plain := decode[Note](t, serve(t, r, "POST", "/api/notes", `{"text":"untagged"}`, http.StatusCreated))
+	if plain.Tags == nil || len(plain.Tags) != 0 {
+		t.Errorf("POST without tags: tags = %#v, want []", plain.Tags)
+	}
+
+	ids := func(path string) []int {
+		t.Helper()
+		var got []int
+		for _, note := range decode[NotesPage](t, serve(t, r, "GET", path, "", http.StatusOK)).Notes {
+			got = append(got, note.ID)
+		}
+		return got
+	}
+	if got := ids("/api/notes?tag=home&tag=work"); !slices.Equal(got, []int{work.ID, created.ID}) {
+		t.Errorf("tag=home&tag=work = %v", got)
+	}
+	if got := ids("/api/notes?tag=home&tag=errands&match=all"); !slices.Equal(got, []int{created.ID}) {
+		t.Errorf("tag=home&tag=errands&match=all = %v", got)
+	}
+	if got := ids("/api/notes?tag=home&tag=work&match=all"); len(got) != 0 {
+		t.Errorf("tag=home&tag=work&match=all = %v", got)
+	}
+	errBody := decode[ErrorResponse](t, serve(t, r, "GET", "/api/notes?tag=x&match=most", "", http.StatusBadRequest))
+	if errBody.Error != "Invalid tag filter" {
+		t.Errorf("bad match error = %q", errBody.Error)
+	}
+
+	path := "/api/notes/" + strconv.Itoa(created.ID)
+	patched := decode[Note](t, serve(t, r, "PATCH", path, `{"tags":["home"]}`, http.StatusOK))
+	if patched.Text != "groceries" || !slices.Equal(patched.Tags, []string{"home"}) {
+		t.Errorf("PATCH tags = %+v", patched)
+	}
+	patched = decode[Note](t, serve(t, r, "PATCH", path, `{"text":"groceries for the week"}`, http.StatusOK))
+	if !slices.Equal(patched.Tags, []string{"home"}) {
+		t.Errorf("PATCH text changed tags to %v", patched.Tags)
+	}
+	// PUT replaces the whole note, tags included.
+	put := decode[Note](t, serve(t, r, "PUT", path, `{"text":"groceries"}`, http.StatusOK))
+	if len(put.Tags) != 0 {
+		t.Errorf("PUT without tags kept %v", put.Tags)
+	}
+
+	for _, req := range []struct{ method, path, body, error string }{
+		{"POST", "/api/notes", `{"text":"x","tags":[""]}`, "Tags must not be empty"},
+		{"PUT", path, `{"text":"x","tags":["` + strings.Repeat("x", maxTagLength+1) + `"]}`, "Tags must be at most 50 characters"},
+		{"PATCH", path, `{"tags":[" "]}`, "Tags must not be empty"},
+	} {
+		errBody := decode[ErrorResponse](t, serve(t, r, req.method, req.path, req.body, http.StatusBadRequest))
+		if errBody.Error != req.error {
+			t.Errorf("%s %s: error = %q, want %q", req.method, req.body, errBody.Error, req.error)
+		}
+	}
+}
+
+func TestTagsHandler(t *testing.T) {
+	r := newNotesRouter(newMemoryNoteStore())
+	alice := asUser("alice", r)
+
+	serve(t, alice, "POST", "/api/notes", `{"text":"a","tags":["work","urgent"]}`, http.StatusCreated)
+	serve(t, alice, "POST", "/api/notes", `{"text":"b","tags":["work"]}`, http.StatusCreated)
+	trashed := decode[Note](t, serve(t, alice, "POST", "/api/notes", `{"text":"c","tags":["old"]}`, http.StatusCreated))
+	serve(t, alice, "DELETE", "/api/notes/"+strconv.Itoa(trashed.ID), "", http.StatusOK)
+	serve(t, asUser("bob", r), "POST", "/api/notes", `{"text":"d","tags":["work"]}`, http.StatusCreated)
+
+	got := decode[[]TagCount](t, serve(t, alice, "GET", "/api/tags", "", http.StatusOK))
+	want := []TagCount{{Name: "urgent", Count: 1}, {Name: "work", Count: 2}}
+	if !slices.Equal(got, want) {
+		t.Errorf("GET /api/tags = %+v, want %+v", got, want)
+	}
+	if got := decode[[]TagCount](t, serve(t, r, "GET", "/api/tags", "", http.StatusOK)); len(got) != 0 {
+		t.Errorf("anonymous GET /api/tags = %+v, want []", got)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// statusClientClosedRequest is nginx's non-standard status for a request the
+// client abandoned. The client never sees it; it keeps such requests apart
+// from server errors in logs and metrics.
+const statusClientClosedRequest = 499
+
+// queryTimeout bounds each database call made while serving a request. main
+// sets it from database.query_timeout.
+var queryTimeout = 5 * time.Second
+
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+// writeDatabaseError answers a failed database call made with ctx: 499 when
+// the client went away, 504 when the call ran past its deadline and 500
+// otherwise. lib/pq reports a cancelled query as an ordinary server error,
+// so the context decides rather than err.
+func writeDatabaseError(ctx context.Context, w http.ResponseWriter, err error) {
+	status, message := http.StatusInternalServerError, "Database error"
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		slog.WarnContext(ctx, "Request cancelled by client", "error", err)
+		status, message = statusClientClosedRequest, "Request cancelled"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		slog.WarnContext(ctx, "Database query timed out", "timeout", queryTimeout.String(), "error", err)
+		status, message = http.StatusGatewayTimeout, "Database timeout"
+	default:
+		slog.ErrorContext(ctx, "Database error", "error", err)
+	}
+
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(newErrorResponse(ctx, message))
+	if err != nil {
+		return
+	}
+}
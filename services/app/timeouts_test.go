@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// blockingConnector hands out connections whose queries block until their
+// context ends and then report that context's error, like a stuck query
+// that the driver cancels.
+type blockingConnector struct {
+	seen chan error
+}
+
+func (c blockingConnector) Connect(context.Context) (driver.Conn, error) {
+	return blockingConn(c), nil
+}
+
+func (c blockingConnector) Driver() driver.Driver { return nil }
+
+type blockingConn struct {
+	seen chan error
+}
+
+func (c blockingConn) block(ctx context.Context) error {
+	<-ctx.Done()
+	c.seen <- ctx.Err()
+	// Mirror lib/pq, which reports a server-side cancel, not ctx.Err().
+	return errors.New("pq: canceling statement due to user request")
+}
+
+func (c blockingConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	return nil, c.block(ctx)
+}
+
+func (c blockingConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	return nil, c.block(ctx)
+}
+
+func (c blockingConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c blockingConn) Close() error                        { return nil }
+func (c blockingConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+// BeginTx succeeds so that statements run in a transaction block like any
+// other.
+func (c blockingConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return blockingTx{}, nil
+}
+
+type blockingTx struct{}
+
+func (blockingTx) Commit() error   { return nil }
+func (blockingTx) Rollback() error { return nil }
+
+func blockingRouter() (*mux.Router, chan error) {
+	seen := make(chan error, 1)
+	db := sql.OpenDB(blockingConnector{seen: seen})
+	store := newPostgresNoteStore(db)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/notes", getNotesHandler(store, nil)).Methods("GET")
+	r.HandleFunc("/api/notes", createNoteHandler(store, nil)).Methods("POST")
+	r.HandleFunc("/api/notes/search", searchNotesHandler(store)).Methods("GET")
+	r.HandleFunc("/api/notes/{id}", getNoteHandler(store)).Methods("GET")
+	r.HandleFunc("/api/notes/{id}", updateNoteHandler(store, nil)).Methods("PUT")
+	r.HandleFunc("/api/notes/{id}", deleteNoteHandler(store, nil)).Methods("DELETE")
+	return r, seen
+}
+
+var blockingRequests = []struct{ method, path, body string }{
+	{"GET", "/api/notes", ""},
+	{"POST", "/api/notes", `{"text":"x"}`},
+	{"GET", "/api/notes/search?q=x", ""},
+	{"GET", "/api/notes/1", ""},
+	{"PUT", "/api/notes/1", `{"text":"x"}`},
+	{"DELETE", "/api/notes/1", ""},
+}
+
+func checkErrorBody(t *testing.T, rr *httptest.ResponseRecorder, wantCode int, wantError string) {
+	t.Helper()
+
+	if rr.Code != wantCode {
+		t.Errorf("code = %d, want %d", rr.Code, wantCode)
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != wantError {
+		t.Errorf("error = %q, want %q", body.Error, wantError)
+	}
+}
+
+func TestClientCancellationReachesDriver(t *testing.T) {
+	r, seen := blockingRouter()
+
+	for _, tt := range blockingRequests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)).WithContext(ctx)
+			time.AfterFunc(20*time.Millisecond, cancel)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if err := <-seen; !errors.Is(err, context.Canceled) {
+				t.Errorf("driver saw %v, want context.Canceled", err)
+			}
+			checkErrorBody(t, rr, statusClientClosedRequest, "Request cancelled")
+		})
+	}
+}
+
+func TestQueryTimeoutReachesDriver(t *testing.T) {
+	previous := queryTimeout
+	queryTimeout = 20 * time.Millisecond
+	defer func() { queryTimeout = previous }()
+
+	r, seen := blockingRouter()
+
+	for _, tt := range blockingRequests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			r.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("handler took %v, want about the query timeout", elapsed)
+			}
+			if err := <-seen; !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("driver saw %v, want context.DeadlineExceeded", err)
+			}
+			checkErrorBody(t, rr, http.StatusGatewayTimeout, "Database timeout")
+		})
+	}
+}
+
+func TestCancelledQueryStopsOnServer(t *testing.T) {
+	db := testDB(t)
+
+	// Hold a lock that makes the handler's SELECT wait on the server.
+	locker, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer locker.Rollback()
+	if _, err := locker.Exec("LOCK TABLE notes IN ACCESS EXCLUSIVE MODE"); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/notes/{id}", getNoteHandler(newPostgresNoteStore(db))).Methods("GET")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/api/notes/1", nil).WithContext(ctx))
+
+	checkErrorBody(t, rr, statusClientClosedRequest, "Request cancelled")
+
+	// lib/pq sends a cancel request asynchronously; give it a moment.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var waiting int
+		err := locker.QueryRow(`
+			SELECT count(*) FROM pg_stat_activity
+			WHERE wait_event_type = 'Lock' AND query LIKE 'SELECT id, text%FROM notes WHERE id%'`).Scan(&waiting)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if waiting == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cancelled query is still waiting on the server")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
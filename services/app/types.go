@@ -3,7 +3,8 @@ package main
 import "net/http"
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 type responseWriter struct {
@@ -0,0 +1,4 @@
+-- Drop full-text search index and vector
+DROP INDEX IF EXISTS idx_notes_search_vector;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS search_vector;
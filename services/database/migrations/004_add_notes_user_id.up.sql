@@ -0,0 +1,8 @@
+-- Add the owning user to notes. Existing notes belong to the anonymous user
+-- '', which is also the owner used while authentication is disabled.
+ALTER TABLE notes
+    ADD COLUMN IF NOT EXISTS user_id TEXT NOT NULL DEFAULT '';
+
+-- Replace the created_at index with one that serves per-user pages
+DROP INDEX IF EXISTS idx_notes_created_at;
+CREATE INDEX IF NOT EXISTS idx_notes_user_id_created_at ON notes (user_id, created_at DESC, id DESC);
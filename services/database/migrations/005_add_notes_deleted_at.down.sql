@@ -0,0 +1,5 @@
+-- Drop soft delete. Notes still in the trash are removed for good.
+DROP INDEX IF EXISTS idx_notes_trash;
+
+DELETE FROM notes WHERE deleted_at IS NOT NULL;
+ALTER TABLE notes DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,7 @@
+-- Drop note revisions together with the triggers that record them
+DROP TRIGGER IF EXISTS record_notes_revision_on_update ON notes;
+DROP TRIGGER IF EXISTS record_notes_revision_on_insert ON notes;
+
+DROP FUNCTION IF EXISTS record_note_revision();
+
+DROP TABLE IF EXISTS note_revisions;
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type postgresNoteStore struct {
+	db *sql.DB
+}
+
+func newPostgresNoteStore(db *sql.DB) *postgresNoteStore {
+	return &postgresNoteStore{db: db}
+}
+
+// noteColumns selects a note together with its tags, sorted by name.
+const noteColumns = `id, text, created_at, updated_at, deleted_at,
+	ARRAY(SELECT t.name FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE nt.note_id = notes.id ORDER BY t.name)`
+
+func scanNote(row interface{ Scan(...any) error }, extra ...any) (Note, error) {
+	var note Note
+	dest := append([]any{&note.ID, &note.Text, &note.CreatedAt, &note.UpdatedAt, &note.DeletedAt, pq.Array(&note.Tags)}, extra...)
+	err := row.Scan(dest...)
+	return note, err
+}
+
+func (s *postgresNoteStore) Create(ctx context.Context, userID, text string, tags []string) (Note, error) {
+	var note Note
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var id int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO notes (user_id, text)
+			VALUES ($1, $2)
+			RETURNING id`,
+			userID, text).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if err := setNoteTags(ctx, tx, userID, id, tags); err != nil {
+			return err
+		}
+		note, err = scanNote(tx.QueryRowContext(ctx, "SELECT "+noteColumns+" FROM notes WHERE id = $1", id))
+		return err
+	})
+	return note, err
+}
+
+func (s *postgresNoteStore) Get(ctx context.Context, userID string, id int) (Note, error) {
+	note, err := scanNote(s.db.QueryRowContext(ctx, "SELECT "+noteColumns+" FROM notes WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Note{}, errNoteNotFound
+	}
+	return note, err
+}
+
+func (s *postgresNoteStore) List(ctx context.Context, userID string, filter noteFilter, limit int, cursor *noteCursor) (NotesPage, error) {
+	return s.page(ctx, false, userID, filter, limit, cursor)
+}
+
+func (s *postgresNoteStore) Trash(ctx context.Context, userID string, limit int, cursor *noteCursor) (NotesPage, error) {
+	return s.page(ctx, true, userID, noteFilter{}, limit, cursor)
+}
+
+// page uses keyset pagination on (created_at, id) over the live or the
+// trashed notes. One extra row is requested to find out whether a next page
+// exists.
+func (s *postgresNoteStore) page(ctx context.Context, trashed bool, userID string, filter noteFilter, limit int, cursor *noteCursor) (NotesPage, error) {
+	where := []string{"user_id = $1", "deleted_at IS NULL"}
+	if trashed {
+		where[1] = "deleted_at IS NOT NULL"
+	}
+	args := []any{userID}
+
+	// Count the filter tags a note carries: any match needs one, all needs
+	// every one. Filter tags are normalized, so they have no duplicates.
+	if len(filter.Tags) > 0 {
+		args = append(args, pq.Array(filter.Tags))
+		matched := fmt.Sprintf(`(
+			SELECT COUNT(*)
+			FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE nt.note_id = notes.id AND t.name = ANY($%d))`, len(args))
+		if filter.MatchAll {
+			where = append(where, matched+" = "+strconv.Itoa(len(filter.Tags)))
+		} else {
+			where = append(where, matched+" > 0")
+		}
+	}
+	if cursor != nil {
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $`+strconv.Itoa(len(args)),
+		args...)
+	if err != nil {
+		return NotesPage{}, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	notes := []Note{}
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return NotesPage{}, err
+		}
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return NotesPage{}, err
+	}
+
+	return newNotesPage(notes, limit), nil
+}
+
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+
+// escapedNoteText escapes text as html.EscapeString does, so the headline
+// built from it is safe to insert as HTML apart from its <mark> tags.
+const escapedNoteText = `replace(replace(replace(replace(replace(text, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+
+func (s *postgresNoteStore) Search(ctx context.Context, userID string, query searchQuery, limit int) ([]NoteSearchResult, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`,
+		       ts_rank(search_vector, query) AS rank,
+		       ts_headline('simple', `+escapedNoteText+`, query, $2)
+		FROM notes, to_tsquery('simple', $1) AS query
+		WHERE search_vector @@ query AND user_id = $4 AND deleted_at IS NULL
+		ORDER BY rank DESC, id DESC
+		LIMIT $3`,
+		query.tsquery(), searchHeadlineOptions, limit, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	results := []NoteSearchResult{}
+	for rows.Next() {
+		var result NoteSearchResult
+		note, err := scanNote(rows, &result.Rank, &result.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		result.Note = note
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Create, Update and Purge rely on the record_notes_revision_* triggers and
+// the cascading foreign key to keep note_revisions in step.
+
+// Update relies on the update_notes_updated_at trigger for updated_at, which
+// also moves when only the tags change.
+func (s *postgresNoteStore) Update(ctx context.Context, userID string, id int, changes noteChanges) (Note, error) {
+	var note Note
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			UPDATE notes
+			SET text = COALESCE($1, text)
+			WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
+			RETURNING id`,
+			changes.Text, id, userID).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errNoteNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if changes.Tags != nil {
+			if err := setNoteTags(ctx, tx, userID, id, *changes.Tags); err != nil {
+				return err
+			}
+		}
+		note, err = scanNote(tx.QueryRowContext(ctx, "SELECT "+noteColumns+" FROM notes WHERE id = $1", id))
+		return err
+	})
+	return note, err
+}
+
+func (s *postgresNoteStore) Delete(ctx context.Context, userID string, id int) error {
+	return s.exec(ctx, "UPDATE notes SET deleted_at = NOW() WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL", id, userID)
+}
+
+func (s *postgresNoteStore) Restore(ctx context.Context, userID string, id int) (Note, error) {
+	note, err := scanNote(s.db.QueryRowContext(ctx, `
+		UPDATE notes
+		SET deleted_at = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		RETURNING `+noteColumns,
+		id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Note{}, errNoteNotFound
+	}
+	return note, err
+}
+
+func (s *postgresNoteStore) Purge(ctx context.Context, userID string, id int) error {
+	return s.exec(ctx, "DELETE FROM notes WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL", id, userID)
+}
+
+// Revisions joins notes so that a foreign or trashed note yields no rows;
+// every visible note has at least its first revision.
+func (s *postgresNoteStore) Revisions(ctx context.Context, userID string, id int) ([]NoteRevision, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.revision, r.text, r.created_at
+		FROM note_revisions r
+		JOIN notes n ON n.id = r.note_id
+		WHERE r.note_id = $1 AND n.user_id = $2 AND n.deleted_at IS NULL
+		ORDER BY r.revision DESC`,
+		id, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	revisions := []NoteRevision{}
+	for rows.Next() {
+		var revision NoteRevision
+		if err := rows.Scan(&revision.Revision, &revision.Text, &revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, errNoteNotFound
+	}
+	return revisions, nil
+}
+
+func (s *postgresNoteStore) Revision(ctx context.Context, userID string, id, revision int) (NoteRevision, error) {
+	if _, err := s.Get(ctx, userID, id); err != nil {
+		return NoteRevision{}, err
+	}
+
+	result := NoteRevision{Revision: revision}
+	err := s.db.QueryRowContext(ctx, "SELECT text, created_at FROM note_revisions WHERE note_id = $1 AND revision = $2", id, revision).
+		Scan(&result.Text, &result.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NoteRevision{}, errRevisionNotFound
+	}
+	return result, err
+}
+
+// exec runs a statement on a single note, reporting errNoteNotFound when it
+// matched no row.
+func (s *postgresNoteStore) exec(ctx context.Context, query string, id int, userID string) error {
+	result, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return errNoteNotFound
+	}
+	return nil
+}
+
+func (s *postgresNoteStore) Tags(ctx context.Context, userID string) ([]TagCount, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.name, COUNT(*)
+		FROM tags t
+		JOIN note_tags nt ON nt.tag_id = t.id
+		JOIN notes n ON n.id = nt.note_id
+		WHERE t.user_id = $1 AND n.deleted_at IS NULL
+		GROUP BY t.name
+		ORDER BY t.name`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		err := rows.Close()
+		if err != nil {
+
+		}
+	}(rows)
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// setNoteTags replaces the tags of note id, creating tags the user does not
+// have yet.
+func setNoteTags(ctx context.Context, tx *sql.Tx, userID string, id int, tags []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM note_tags WHERE note_id = $1", id); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO tags (user_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (user_id, name) DO NOTHING`,
+		userID, pq.Array(tags))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO note_tags (note_id, tag_id)
+		SELECT $1, id FROM tags WHERE user_id = $2 AND name = ANY($3)`,
+		id, userID, pq.Array(tags))
+	return err
+}
+
+// inTx runs fn in a transaction, committing it when fn returns nil.
+func (s *postgresNoteStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
@@ -11,7 +11,8 @@ type NoteResponse struct {
 }
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
 }
 
 type responseWriter struct {